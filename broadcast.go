@@ -0,0 +1,125 @@
+package saola
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Codec serializes broadcast context values so that they can cross service
+// boundaries.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(b []byte) (interface{}, error)
+}
+
+type StringCodec struct{}
+
+func (c StringCodec) Marshal(v interface{}) ([]byte, error) {
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected string but got %T", v)
+	}
+	return []byte(s), nil
+}
+
+func (c StringCodec) Unmarshal(b []byte) (interface{}, error) {
+	return string(b), nil
+}
+
+// BroadcastKey identifies a context value that is propagated to downstream
+// services by the protocol specific broadcast filters.
+type BroadcastKey struct {
+	name  string
+	codec Codec
+}
+
+var (
+	broadcastLock sync.RWMutex
+	broadcastKeys = make(map[string]*BroadcastKey)
+)
+
+// NewBroadcastKey registers a broadcast key under a name that must be unique
+// and the same in all the services exchanging the value. Names are case
+// insensitive as they are usually transported in headers.
+func NewBroadcastKey(name string, codec Codec) *BroadcastKey {
+	broadcastLock.Lock()
+	defer broadcastLock.Unlock()
+	if _, ok := broadcastKeys[strings.ToLower(name)]; ok {
+		panic("broadcast key already registered: " + name)
+	}
+	k := &BroadcastKey{name, codec}
+	broadcastKeys[strings.ToLower(name)] = k
+	return k
+}
+
+func (k *BroadcastKey) Name() string {
+	return k.name
+}
+
+type broadcastContextKey struct{}
+
+type broadcastValues map[*BroadcastKey]interface{}
+
+func getBroadcastValues(ctx context.Context) broadcastValues {
+	values, _ := ctx.Value(broadcastContextKey{}).(broadcastValues)
+	return values
+}
+
+func (k *BroadcastKey) WithValue(ctx context.Context, v interface{}) context.Context {
+	values := getBroadcastValues(ctx)
+	updated := make(broadcastValues, len(values)+1)
+	for key, value := range values {
+		updated[key] = value
+	}
+	updated[k] = v
+	return context.WithValue(ctx, broadcastContextKey{}, updated)
+}
+
+func (k *BroadcastKey) Value(ctx context.Context) (interface{}, bool) {
+	v, ok := getBroadcastValues(ctx)[k]
+	return v, ok
+}
+
+// MarshalBroadcast serializes all the broadcast values in the context keyed
+// by the name of their key.
+func MarshalBroadcast(ctx context.Context) (map[string][]byte, error) {
+	values := getBroadcastValues(ctx)
+	marshalled := make(map[string][]byte, len(values))
+	for k, v := range values {
+		b, err := k.codec.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("broadcast %s: %s", k.name, err)
+		}
+		marshalled[k.name] = b
+	}
+	return marshalled, nil
+}
+
+// UnmarshalBroadcast restores serialized broadcast values into the context.
+// Values of keys that are not registered are ignored.
+func UnmarshalBroadcast(ctx context.Context, marshalled map[string][]byte) (context.Context, error) {
+	if len(marshalled) == 0 {
+		return ctx, nil
+	}
+	values := getBroadcastValues(ctx)
+	updated := make(broadcastValues, len(values)+len(marshalled))
+	for key, value := range values {
+		updated[key] = value
+	}
+	broadcastLock.RLock()
+	defer broadcastLock.RUnlock()
+	for name, b := range marshalled {
+		k, ok := broadcastKeys[strings.ToLower(name)]
+		if !ok {
+			continue
+		}
+		v, err := k.codec.Unmarshal(b)
+		if err != nil {
+			return ctx, fmt.Errorf("broadcast %s: %s", name, err)
+		}
+		updated[k] = v
+	}
+	return context.WithValue(ctx, broadcastContextKey{}, updated), nil
+}
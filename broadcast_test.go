@@ -0,0 +1,75 @@
+package saola_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	tenantKey = saola.NewBroadcastKey("test.tenant", saola.StringCodec{})
+	userKey   = saola.NewBroadcastKey("test.user", saola.StringCodec{})
+	failKey   = saola.NewBroadcastKey("test.fail", failingCodec{})
+)
+
+type failingCodec struct{}
+
+func (c failingCodec) Marshal(v interface{}) ([]byte, error) {
+	return nil, errors.New("marshal")
+}
+
+func (c failingCodec) Unmarshal(b []byte) (interface{}, error) {
+	return nil, errors.New("unmarshal")
+}
+
+func TestBroadcastKeyValue(t *testing.T) {
+	ctx := tenantKey.WithValue(context.Background(), "acme")
+	v, ok := tenantKey.Value(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "acme", v)
+
+	_, ok = userKey.Value(ctx)
+	assert.False(t, ok)
+
+	ctx2 := tenantKey.WithValue(ctx, "other")
+	v, _ = tenantKey.Value(ctx)
+	assert.Equal(t, "acme", v, "parent context should not be modified")
+	v, _ = tenantKey.Value(ctx2)
+	assert.Equal(t, "other", v)
+}
+
+func TestBroadcastKeyDuplicate(t *testing.T) {
+	assert.Panics(t, func() {
+		saola.NewBroadcastKey("TEST.tenant", saola.StringCodec{})
+	})
+}
+
+func TestBroadcastMarshalRoundtrip(t *testing.T) {
+	ctx := tenantKey.WithValue(context.Background(), "acme")
+	ctx = userKey.WithValue(ctx, "bob")
+	marshalled, err := saola.MarshalBroadcast(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"test.tenant": []byte("acme"),
+		"test.user":   []byte("bob"),
+	}, marshalled)
+
+	marshalled["unknown"] = []byte("ignored")
+	restored, err := saola.UnmarshalBroadcast(context.Background(), marshalled)
+	assert.NoError(t, err)
+	v, _ := tenantKey.Value(restored)
+	assert.Equal(t, "acme", v)
+	v, _ = userKey.Value(restored)
+	assert.Equal(t, "bob", v)
+}
+
+func TestBroadcastCodecError(t *testing.T) {
+	_, err := saola.MarshalBroadcast(failKey.WithValue(context.Background(), 1))
+	assert.Error(t, err)
+
+	_, err = saola.UnmarshalBroadcast(context.Background(), map[string][]byte{"test.fail": nil})
+	assert.Error(t, err)
+}
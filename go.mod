@@ -0,0 +1,14 @@
+module github.com/arjantop/saola
+
+go 1.21
+
+require (
+	github.com/garyburd/redigo v1.6.0
+	github.com/julienschmidt/httprouter v1.3.0
+	github.com/stretchr/testify v1.1.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -0,0 +1,235 @@
+package saola
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/arjantop/saola/stats"
+)
+
+// Attempt is a single copy of a request created by a Fork. Exactly one of
+// Commit or Discard is called for every attempt. The context of an attempt is
+// cancelled when it loses and after it is committed.
+type Attempt interface {
+	// Commit publishes the result of the attempt to the original request.
+	Commit()
+	// Discard releases the resources held by a losing attempt.
+	Discard()
+}
+
+// Fork creates an independent copy of the request carried in ctx so that it
+// can be executed concurrently with other attempts. The primary attempt has
+// number 0 and the backup request number 1. A nil Attempt means the request
+// must not be hedged.
+type Fork func(ctx context.Context, n int) (context.Context, Attempt)
+
+type HedgingPolicy struct {
+	// Delay after which a backup request is sent. When zero the delay is
+	// derived from the Percentile of the observed latencies.
+	Delay time.Duration
+	// Percentile of observed latencies used as the delay, 0.95 by default.
+	Percentile float64
+	// MinDelay bounds the derived delay from below and is used until enough
+	// latencies are observed.
+	MinDelay time.Duration
+	// Budget is the fraction of requests allowed to send a backup request,
+	// 0.1 when unset.
+	Budget float64
+	// Disabled turns the hedging off, the requests are passed through.
+	Disabled bool
+}
+
+const (
+	hedgingWindowSize = 256
+	hedgingMinSamples = 32
+	hedgingMaxBalance = 100
+)
+
+type hedger struct {
+	policy HedgingPolicy
+
+	lock      sync.Mutex
+	latencies [hedgingWindowSize]time.Duration
+	next      int
+	samples   int
+	delay     time.Duration
+	balance   float64
+}
+
+func (h *hedger) deposit() {
+	h.lock.Lock()
+	h.balance += h.policy.Budget
+	if h.balance > hedgingMaxBalance {
+		h.balance = hedgingMaxBalance
+	}
+	h.lock.Unlock()
+}
+
+func (h *hedger) withdraw() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.balance < 1 {
+		return false
+	}
+	h.balance -= 1
+	return true
+}
+
+// refund returns the token of a backup request that was not sent.
+func (h *hedger) refund() {
+	h.lock.Lock()
+	h.balance += 1
+	h.lock.Unlock()
+}
+
+func (h *hedger) observe(latency time.Duration) {
+	if h.policy.Delay != 0 {
+		return
+	}
+	h.lock.Lock()
+	h.latencies[h.next] = latency
+	h.next = (h.next + 1) % hedgingWindowSize
+	h.samples++
+	if h.samples >= hedgingMinSamples && h.samples%hedgingMinSamples == 0 {
+		n := h.samples
+		if n > hedgingWindowSize {
+			n = hedgingWindowSize
+		}
+		sorted := make([]time.Duration, n)
+		copy(sorted, h.latencies[:n])
+		sort.Sort(durations(sorted))
+		h.delay = sorted[int(float64(n-1)*h.policy.Percentile)]
+	}
+	h.lock.Unlock()
+}
+
+func (h *hedger) currentDelay() time.Duration {
+	if h.policy.Delay != 0 {
+		return h.policy.Delay
+	}
+	h.lock.Lock()
+	delay := h.delay
+	h.lock.Unlock()
+	if delay < h.policy.MinDelay {
+		return h.policy.MinDelay
+	}
+	return delay
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+
+type attemptResult struct {
+	n       int
+	err     error
+	latency time.Duration
+}
+
+// NewHedgingFilter sends a backup request when the primary one does not
+// complete within the policy delay. The first successful attempt wins and the
+// other one is cancelled through its context. It panics when the Percentile
+// is not between 0 and 1 or the Budget is negative.
+func NewHedgingFilter(policy HedgingPolicy, fork Fork, stats stats.StatsReceiver) Filter {
+	if policy.Percentile < 0 || policy.Percentile > 1 {
+		panic("hedging percentile must be between 0 and 1")
+	}
+	if policy.Budget < 0 {
+		panic("hedging budget must not be negative")
+	}
+	if policy.Disabled {
+		return FuncFilter(func(ctx context.Context, s Service) error {
+			return s.Do(ctx)
+		})
+	}
+	if policy.Percentile == 0 {
+		policy.Percentile = 0.95
+	}
+	if policy.Budget == 0 {
+		policy.Budget = 0.1
+	}
+	h := &hedger{policy: policy}
+	return FuncFilter(func(ctx context.Context, s Service) error {
+		h.deposit()
+
+		var attempts [2]Attempt
+		var cancels [2]context.CancelFunc
+		results := make(chan attemptResult, 2)
+		launch := func(n int) bool {
+			actx, cancel := context.WithCancel(ctx)
+			fctx, attempt := fork(actx, n)
+			if attempt == nil {
+				cancel()
+				return false
+			}
+			attempts[n] = attempt
+			cancels[n] = cancel
+			go func() {
+				start := time.Now()
+				err := s.Do(fctx)
+				results <- attemptResult{n, err, time.Now().Sub(start)}
+			}()
+			return true
+		}
+
+		if !launch(0) {
+			return s.Do(ctx)
+		}
+
+		hedgeStats := stats.Scope(s.Name()).Scope("hedge")
+		timer := time.NewTimer(h.currentDelay())
+		defer timer.Stop()
+
+		running := 1
+		var first *attemptResult
+		for {
+			select {
+			case <-timer.C:
+				if !h.withdraw() {
+					continue
+				}
+				if launch(1) {
+					running++
+					hedgeStats.Counter("sent").Incr()
+				} else {
+					h.refund()
+				}
+				continue
+			case r := <-results:
+				running--
+				if r.err != nil && running > 0 {
+					first = &r
+					continue
+				}
+				if r.err == nil {
+					h.observe(r.latency)
+				} else if first != nil {
+					r = *first
+				}
+				attempts[r.n].Commit()
+				cancels[r.n]()
+				if r.n == 1 {
+					hedgeStats.Counter("won").Incr()
+				}
+				for n, attempt := range attempts {
+					if attempt != nil && n != r.n {
+						cancels[n]()
+						if running > 0 {
+							go func(a Attempt) {
+								<-results
+								a.Discard()
+							}(attempt)
+						} else {
+							attempt.Discard()
+						}
+					}
+				}
+				return r.err
+			}
+		}
+	})
+}
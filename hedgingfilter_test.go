@@ -0,0 +1,171 @@
+package saola_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/stats/statstest"
+	"github.com/stretchr/testify/assert"
+)
+
+type attemptKey struct{}
+
+type testAttempt struct {
+	n         int
+	winner    *int
+	discarded chan int
+}
+
+func (a testAttempt) Commit() {
+	*a.winner = a.n
+}
+
+func (a testAttempt) Discard() {
+	a.discarded <- a.n
+}
+
+func newTestFork(winner *int, discarded chan int) saola.Fork {
+	return func(ctx context.Context, n int) (context.Context, saola.Attempt) {
+		return context.WithValue(ctx, attemptKey{}, n), testAttempt{n, winner, discarded}
+	}
+}
+
+func attemptService(latencies ...time.Duration) saola.Service {
+	return saola.FuncService(func(ctx context.Context) error {
+		n, _ := ctx.Value(attemptKey{}).(int)
+		select {
+		case <-time.After(latencies[n]):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+func TestHedgingFilterBackupWins(t *testing.T) {
+	r := statstest.NewRecorder()
+	winner := -1
+	discarded := make(chan int, 1)
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Millisecond, Budget: 1}, newTestFork(&winner, discarded), r)
+
+	err := f.Do(context.Background(), attemptService(time.Second, time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, winner)
+	assert.Equal(t, 0, <-discarded)
+	assert.Equal(t, int64(1), r.CounterValue("func.hedge.sent"))
+	assert.Equal(t, int64(1), r.CounterValue("func.hedge.won"))
+}
+
+func TestHedgingFilterPrimaryWins(t *testing.T) {
+	r := statstest.NewRecorder()
+	winner := -1
+	discarded := make(chan int, 1)
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Second, Budget: 1}, newTestFork(&winner, discarded), r)
+
+	err := f.Do(context.Background(), attemptService(time.Millisecond, time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, winner)
+	assert.Equal(t, int64(0), r.CounterValue("func.hedge.sent"))
+}
+
+func TestHedgingFilterBudget(t *testing.T) {
+	r := statstest.NewRecorder()
+	winner := -1
+	discarded := make(chan int, 1)
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Microsecond, Budget: 0.5}, newTestFork(&winner, discarded), r)
+
+	for i := 0; i < 4; i++ {
+		err := f.Do(context.Background(), attemptService(5*time.Millisecond, time.Millisecond))
+		assert.NoError(t, err)
+		select {
+		case <-discarded:
+		default:
+		}
+	}
+	assert.Equal(t, int64(2), r.CounterValue("func.hedge.sent"))
+}
+
+func TestHedgingFilterBudgetRefund(t *testing.T) {
+	r := statstest.NewRecorder()
+	winner := -1
+	discarded := make(chan int, 1)
+	fork := newTestFork(&winner, discarded)
+	backups := 0
+	refusingFork := func(ctx context.Context, n int) (context.Context, saola.Attempt) {
+		if n == 1 {
+			if backups++; backups == 1 {
+				return ctx, nil
+			}
+		}
+		return fork(ctx, n)
+	}
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Microsecond, Budget: 0.5}, refusingFork, r)
+
+	for i := 0; i < 3; i++ {
+		err := f.Do(context.Background(), attemptService(5*time.Millisecond, time.Millisecond))
+		assert.NoError(t, err)
+		select {
+		case <-discarded:
+		default:
+		}
+	}
+	assert.Equal(t, 2, backups)
+	assert.Equal(t, int64(1), r.CounterValue("func.hedge.sent"), "backup that was not forked is refunded")
+}
+
+func TestHedgingFilterCancelsWinner(t *testing.T) {
+	r := statstest.NewRecorder()
+	winner := -1
+	discarded := make(chan int, 1)
+	var winnerCtx context.Context
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Second, Budget: 1}, newTestFork(&winner, discarded), r)
+
+	err := f.Do(context.Background(), saola.FuncService(func(ctx context.Context) error {
+		winnerCtx = ctx
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, winner)
+	assert.Equal(t, context.Canceled, winnerCtx.Err())
+}
+
+func TestHedgingFilterDisabled(t *testing.T) {
+	r := statstest.NewRecorder()
+	winner := -1
+	discarded := make(chan int, 1)
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Microsecond, Disabled: true}, newTestFork(&winner, discarded), r)
+
+	err := f.Do(context.Background(), attemptService(5*time.Millisecond))
+	assert.NoError(t, err)
+	assert.Equal(t, -1, winner, "request should not be forked")
+	assert.Equal(t, int64(0), r.CounterValue("func.hedge.sent"))
+}
+
+func TestHedgingFilterInvalidPolicy(t *testing.T) {
+	fork := newTestFork(new(int), make(chan int, 1))
+	for _, policy := range []saola.HedgingPolicy{{Percentile: 1.5}, {Percentile: -0.5}, {Budget: -1}} {
+		assert.Panics(t, func() {
+			saola.NewHedgingFilter(policy, fork, statstest.NewRecorder())
+		})
+	}
+	assert.NotPanics(t, func() {
+		saola.NewHedgingFilter(saola.HedgingPolicy{Percentile: 1}, fork, statstest.NewRecorder())
+	})
+}
+
+func TestHedgingFilterNotHedgeable(t *testing.T) {
+	r := statstest.NewRecorder()
+	fork := func(ctx context.Context, n int) (context.Context, saola.Attempt) {
+		return ctx, nil
+	}
+	f := saola.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Microsecond, Budget: 1}, fork, r)
+
+	err := f.Do(context.Background(), saola.FuncService(func(ctx context.Context) error {
+		return errors.New("error")
+	}))
+	assert.Equal(t, errors.New("error"), err)
+	assert.Equal(t, int64(0), r.CounterValue("func.hedge.sent"))
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+)
+
+// CredentialStore verifies the user credentials and returns nil when they
+// are not valid.
+type CredentialStore interface {
+	Authenticate(user, password string) (*Principal, error)
+}
+
+// StaticCredentials maps user names to passwords.
+type StaticCredentials map[string]string
+
+func (c StaticCredentials) Authenticate(user, password string) (*Principal, error) {
+	expected, ok := c[user]
+	if !ok || subtle.ConstantTimeCompare([]byte(expected), []byte(password)) != 1 {
+		return nil, nil
+	}
+	return &Principal{Name: user}, nil
+}
+
+// NewBasicAuthFilter authenticates requests with HTTP Basic authentication.
+func NewBasicAuthFilter(realm string, store CredentialStore) saola.Filter {
+	challenge := "Basic realm=" + strconv.Quote(realm)
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := httpservice.GetServerRequest(ctx)
+		user, password, ok := req.Request.BasicAuth()
+		if !ok {
+			return unauthorized(req.Writer, challenge)
+		}
+		p, err := store.Authenticate(user, password)
+		if err != nil {
+			req.Writer.WriteHeader(http.StatusInternalServerError)
+			return err
+		}
+		if p == nil {
+			return unauthorized(req.Writer, challenge)
+		}
+		return s.Do(WithPrincipal(ctx, p))
+	})
+}
+
+func NewClientBasicAuthFilter(user, password string) saola.Filter {
+	credentials := "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		setRequestHeader(ctx, "Authorization", credentials)
+		return s.Do(ctx)
+	})
+}
@@ -0,0 +1,67 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/httpservice/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBasicAuthFilter(t *testing.T) {
+	f := auth.NewBasicAuthFilter("test", auth.StaticCredentials{"bob": "secret"})
+
+	req, w := newRequest("GET", "http://localhost/foo")
+	req.SetBasicAuth("bob", "secret")
+	p, err := serve(f, w, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", p.Name)
+
+	req, w = newRequest("GET", "http://localhost/foo")
+	req.SetBasicAuth("bob", "wrong")
+	_, err = serve(f, w, req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="test"`, w.Header().Get("WWW-Authenticate"))
+
+	req, w = newRequest("GET", "http://localhost/foo")
+	_, err = serve(f, w, req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+}
+
+type failingStore struct{}
+
+func (s failingStore) Authenticate(user, password string) (*auth.Principal, error) {
+	return nil, errors.New("store unavailable")
+}
+
+func TestBasicAuthFilterStoreError(t *testing.T) {
+	req, w := newRequest("GET", "http://localhost/foo")
+	req.SetBasicAuth("bob", "secret")
+	_, err := serve(auth.NewBasicAuthFilter("test", failingStore{}), w, req)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestClientBasicAuthFilter(t *testing.T) {
+	server := saola.Apply(saola.NoopService{}, auth.NewBasicAuthFilter("test", auth.StaticCredentials{"bob": "secret"}))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Do(httpservice.WithServerRequest(context.Background(), w, r))
+	}))
+	defer ts.Close()
+
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    auth.NewClientBasicAuthFilter("bob", "secret"),
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := c.Do(context.Background(), req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+)
+
+const hmacScheme = "HMAC-SHA256"
+
+type HMACConfig struct {
+	// Keys returns the secret for the key id.
+	Keys func(keyID string) ([]byte, bool)
+	// MaxSkew is the tolerated difference between the signature timestamp and
+	// the current time, 5 minutes by default.
+	MaxSkew time.Duration
+	// Now is the current time, time.Now by default.
+	Now func() time.Time
+	// MaxBodySize is the size of the largest body that is read to verify the
+	// signature, 10MB by default.
+	MaxBodySize int64
+}
+
+// readBody reads the whole body and replaces it so it can be read again.
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+func requestHost(r *http.Request) string {
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL.Host
+}
+
+func hmacSignature(secret []byte, r *http.Request, timestamp int64, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%d\n%s", r.Method, requestHost(r), r.URL.RequestURI(), timestamp, hex.EncodeToString(bodyHash[:]))
+	return mac.Sum(nil)
+}
+
+func parseHMACAuthorization(authorization string) (keyID string, timestamp int64, signature []byte, ok bool) {
+	if !strings.HasPrefix(authorization, hmacScheme+" ") {
+		return "", 0, nil, false
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(authorization[len(hmacScheme)+1:], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+	timestamp, err := strconv.ParseInt(params["Timestamp"], 10, 64)
+	if err != nil {
+		return "", 0, nil, false
+	}
+	signature, err = base64.StdEncoding.DecodeString(params["Signature"])
+	if err != nil || params["KeyId"] == "" {
+		return "", 0, nil, false
+	}
+	return params["KeyId"], timestamp, signature, true
+}
+
+// NewHMACFilter authenticates requests signed with a shared secret. The
+// signature covers the method, host, URI, timestamp and body of the request.
+// The key id is the name of the principal.
+func NewHMACFilter(config HMACConfig) saola.Filter {
+	if config.MaxSkew == 0 {
+		config.MaxSkew = 5 * time.Minute
+	}
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 10 << 20
+	}
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := httpservice.GetServerRequest(ctx)
+		keyID, timestamp, signature, ok := parseHMACAuthorization(req.Request.Header.Get("Authorization"))
+		if !ok {
+			return unauthorized(req.Writer, hmacScheme)
+		}
+		secret, ok := config.Keys(keyID)
+		if !ok {
+			return unauthorized(req.Writer, hmacScheme)
+		}
+		now := time.Now()
+		if config.Now != nil {
+			now = config.Now()
+		}
+		skew := now.Sub(time.Unix(timestamp, 0))
+		if skew > config.MaxSkew || skew < -config.MaxSkew {
+			return unauthorized(req.Writer, hmacScheme)
+		}
+		if req.Request.Body != nil {
+			req.Request.Body = http.MaxBytesReader(req.Writer, req.Request.Body, config.MaxBodySize)
+		}
+		body, err := readBody(req.Request)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			req.Writer.WriteHeader(http.StatusRequestEntityTooLarge)
+			return err
+		} else if err != nil {
+			req.Writer.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+		if !hmac.Equal(signature, hmacSignature(secret, req.Request, timestamp, body)) {
+			return unauthorized(req.Writer, hmacScheme)
+		}
+		return s.Do(WithPrincipal(ctx, &Principal{Name: keyID}))
+	})
+}
+
+// NewClientHMACFilter signs the requests with the secret.
+func NewClientHMACFilter(keyID string, secret []byte) saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		cr := httpservice.GetClientRequest(ctx)
+		body, err := readBody(cr.Request)
+		if err != nil {
+			return err
+		}
+		timestamp := time.Now().Unix()
+		signature := hmacSignature(secret, cr.Request, timestamp, body)
+		setRequestHeader(ctx, "Authorization", fmt.Sprintf("%s KeyId=%s, Timestamp=%d, Signature=%s",
+			hmacScheme, keyID, timestamp, base64.StdEncoding.EncodeToString(signature)))
+		return s.Do(ctx)
+	})
+}
@@ -0,0 +1,121 @@
+package auth_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/httpservice/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// runClientFilter executes the client filter with a service that inspects
+// the outgoing request instead of sending it.
+func runClientFilter(f saola.Filter, req *http.Request, inspect func(r *http.Request)) error {
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter: saola.Chain(f, saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+			inspect(httpservice.GetClientRequest(ctx).Request)
+			return nil
+		})),
+	}
+	_, err := c.Do(context.Background(), req)
+	return err
+}
+
+func hmacKeys(keyID string) ([]byte, bool) {
+	if keyID == "client" {
+		return []byte("shared"), true
+	}
+	return nil, false
+}
+
+func signedRequest(t *testing.T, keyID, secret, body string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://localhost/foo?a=b", strings.NewReader(body))
+	var signed *http.Request
+	err := runClientFilter(auth.NewClientHMACFilter(keyID, []byte(secret)), req, func(r *http.Request) {
+		signed = r
+	})
+	assert.NoError(t, err)
+	return signed
+}
+
+func TestHMACFilter(t *testing.T) {
+	f := auth.NewHMACFilter(auth.HMACConfig{Keys: hmacKeys})
+	req := signedRequest(t, "client", "shared", "body")
+	var body string
+	ctx := httpservice.WithServerRequest(context.Background(), httptest.NewRecorder(), req)
+	err := f.Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		p, _ := auth.GetPrincipal(ctx)
+		assert.Equal(t, "client", p.Name)
+		b, _ := ioutil.ReadAll(httpservice.GetServerRequest(ctx).Request.Body)
+		body = string(b)
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "body", body, "body should still be readable")
+}
+
+func TestHMACFilterInvalid(t *testing.T) {
+	f := auth.NewHMACFilter(auth.HMACConfig{Keys: hmacKeys})
+
+	for name, req := range map[string]*http.Request{
+		"wrong secret":   signedRequest(t, "client", "wrong", "body"),
+		"unknown key id": signedRequest(t, "unknown", "shared", "body"),
+	} {
+		w := httptest.NewRecorder()
+		_, err := serve(f, w, req)
+		assert.Equal(t, auth.ErrUnauthorized, err, name)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+	}
+
+	req := signedRequest(t, "client", "shared", "body")
+	req.Body = ioutil.NopCloser(strings.NewReader("tampered"))
+	w := httptest.NewRecorder()
+	_, err := serve(f, w, req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+
+	req = signedRequest(t, "client", "shared", "body")
+	req.Host = "other.example.com"
+	_, err = serve(f, httptest.NewRecorder(), req)
+	assert.Equal(t, auth.ErrUnauthorized, err, "host is signed")
+}
+
+func TestHMACFilterMaxBodySize(t *testing.T) {
+	f := auth.NewHMACFilter(auth.HMACConfig{Keys: hmacKeys, MaxBodySize: 4})
+
+	w := httptest.NewRecorder()
+	_, err := serve(f, w, signedRequest(t, "client", "shared", "body"))
+	assert.NoError(t, err)
+
+	w = httptest.NewRecorder()
+	_, err = serve(f, w, signedRequest(t, "client", "shared", "large body"))
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestHMACFilterClockSkew(t *testing.T) {
+	req := signedRequest(t, "client", "shared", "")
+
+	f := auth.NewHMACFilter(auth.HMACConfig{
+		Keys:    hmacKeys,
+		MaxSkew: time.Minute,
+		Now:     func() time.Time { return time.Now().Add(30 * time.Second) },
+	})
+	_, err := serve(f, httptest.NewRecorder(), req)
+	assert.NoError(t, err)
+
+	f = auth.NewHMACFilter(auth.HMACConfig{
+		Keys:    hmacKeys,
+		MaxSkew: time.Minute,
+		Now:     func() time.Time { return time.Now().Add(-2 * time.Minute) },
+	})
+	_, err = serve(f, httptest.NewRecorder(), req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+}
@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+)
+
+var (
+	errMalformedToken = errors.New("jwt: malformed token")
+	errUnknownKey     = errors.New("jwt: unknown key")
+	errSignature      = errors.New("jwt: invalid signature")
+	errExpired        = errors.New("jwt: token expired")
+	errNotValidYet    = errors.New("jwt: token not valid yet")
+	errIssuer         = errors.New("jwt: invalid issuer")
+	errAudience       = errors.New("jwt: invalid audience")
+)
+
+// KeySet resolves the keys verifying JWT signatures. HS256 keys are []byte and
+// RS256 keys are *rsa.PublicKey.
+type KeySet interface {
+	Key(kid string) (interface{}, error)
+}
+
+// StaticKeySet maps key ids to keys. A key with an empty id is used for
+// tokens without the "kid" header.
+type StaticKeySet map[string]interface{}
+
+func (ks StaticKeySet) Key(kid string) (interface{}, error) {
+	if k, ok := ks[kid]; ok {
+		return k, nil
+	}
+	return nil, errUnknownKey
+}
+
+type JWTConfig struct {
+	Keys KeySet
+	// Issuer and Audience are verified when set.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew when verifying exp and nbf claims.
+	Leeway time.Duration
+	// Now is the current time, time.Now by default.
+	Now func() time.Time
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+func sign(alg string, key interface{}, signingInput string) ([]byte, error) {
+	switch alg {
+	case "HS256":
+		secret, ok := key.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("jwt: HS256 requires []byte key but got %T", key)
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil), nil
+	case "RS256":
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("jwt: RS256 requires *rsa.PrivateKey but got %T", key)
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		return rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, digest[:])
+	}
+	return nil, fmt.Errorf("jwt: unsupported algorithm %s", alg)
+}
+
+func verify(alg string, key interface{}, signingInput string, signature []byte) error {
+	switch alg {
+	case "HS256":
+		// The type of the key is checked to prevent algorithm confusion.
+		secret, ok := key.([]byte)
+		if !ok {
+			return errSignature
+		}
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errSignature
+		}
+		return nil
+	case "RS256":
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errSignature
+		}
+		digest := sha256.Sum256([]byte(signingInput))
+		if rsa.VerifyPKCS1v15(public, crypto.SHA256, digest[:], signature) != nil {
+			return errSignature
+		}
+		return nil
+	}
+	return errSignature
+}
+
+// SignJWT creates a compact serialized token with the given claims.
+func SignJWT(claims map[string]interface{}, alg, kid string, key interface{}) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: alg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	signature, err := sign(alg, key, signingInput)
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + b64.EncodeToString(signature), nil
+}
+
+func numericClaim(claims map[string]interface{}, name string) (time.Time, bool) {
+	if v, ok := claims[name].(float64); ok {
+		return time.Unix(int64(v), 0), true
+	}
+	return time.Time{}, false
+}
+
+func audienceMatches(aud interface{}, audience string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == audience
+	case []interface{}:
+		for _, v := range a {
+			if s, ok := v.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ParseJWT verifies the token and returns its claims.
+func (c JWTConfig) ParseJWT(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformedToken
+	}
+	var header jwtHeader
+	headerJSON, err := b64.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil {
+		return nil, errMalformedToken
+	}
+	signature, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformedToken
+	}
+	key, err := c.Keys.Key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verify(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	payload, err := b64.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return nil, errMalformedToken
+	}
+	now := time.Now()
+	if c.Now != nil {
+		now = c.Now()
+	}
+	if exp, ok := numericClaim(claims, "exp"); ok && !now.Before(exp.Add(c.Leeway)) {
+		return nil, errExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(c.Leeway).Before(nbf) {
+		return nil, errNotValidYet
+	}
+	if c.Issuer != "" && claims["iss"] != c.Issuer {
+		return nil, errIssuer
+	}
+	if c.Audience != "" && !audienceMatches(claims["aud"], c.Audience) {
+		return nil, errAudience
+	}
+	return claims, nil
+}
+
+// NewJWTFilter authenticates requests carrying a bearer JWT. The "sub" claim
+// is the name of the principal.
+func NewJWTFilter(config JWTConfig) saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := httpservice.GetServerRequest(ctx)
+		authorization := req.Request.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return unauthorized(req.Writer, "Bearer")
+		}
+		claims, err := config.ParseJWT(authorization[len("Bearer "):])
+		if err != nil {
+			return unauthorized(req.Writer, `Bearer error="invalid_token"`)
+		}
+		name, _ := claims["sub"].(string)
+		return s.Do(WithPrincipal(ctx, &Principal{Name: name, Claims: claims}))
+	})
+}
+
+// NewClientBearerFilter sends the token returned by the function as a bearer
+// token.
+func NewClientBearerFilter(token func(ctx context.Context) (string, error)) saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		t, err := token(ctx)
+		if err != nil {
+			return err
+		}
+		setRequestHeader(ctx, "Authorization", "Bearer "+t)
+		return s.Do(ctx)
+	})
+}
@@ -0,0 +1,138 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/httpservice/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	hmacKey    = []byte("secret")
+	rsaKey, _  = rsa.GenerateKey(rand.Reader, 2048)
+	now        = time.Unix(1500000000, 0)
+	testKeySet = auth.StaticKeySet{
+		"hs": hmacKey,
+		"rs": &rsaKey.PublicKey,
+	}
+)
+
+func jwtConfig() auth.JWTConfig {
+	return auth.JWTConfig{
+		Keys:     testKeySet,
+		Issuer:   "issuer",
+		Audience: "service",
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return now },
+	}
+}
+
+func claims(extra map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"sub": "bob",
+		"iss": "issuer",
+		"aud": []string{"other", "service"},
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range extra {
+		c[k] = v
+	}
+	return c
+}
+
+func TestParseJWT(t *testing.T) {
+	for _, tc := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{"HS256", "hs", hmacKey},
+		{"RS256", "rs", rsaKey},
+	} {
+		token, err := auth.SignJWT(claims(nil), tc.alg, tc.kid, tc.key)
+		assert.NoError(t, err)
+		c, err := jwtConfig().ParseJWT(token)
+		assert.NoError(t, err, tc.alg)
+		assert.Equal(t, "bob", c["sub"])
+	}
+}
+
+func TestParseJWTInvalid(t *testing.T) {
+	for name, token := range map[string]func() (string, error){
+		"expired": func() (string, error) {
+			return auth.SignJWT(claims(map[string]interface{}{"exp": now.Add(-2 * time.Minute).Unix()}), "HS256", "hs", hmacKey)
+		},
+		"not valid yet": func() (string, error) {
+			return auth.SignJWT(claims(map[string]interface{}{"nbf": now.Add(2 * time.Minute).Unix()}), "HS256", "hs", hmacKey)
+		},
+		"issuer": func() (string, error) {
+			return auth.SignJWT(claims(map[string]interface{}{"iss": "other"}), "HS256", "hs", hmacKey)
+		},
+		"audience": func() (string, error) {
+			return auth.SignJWT(claims(map[string]interface{}{"aud": "other"}), "HS256", "hs", hmacKey)
+		},
+		"unknown key": func() (string, error) {
+			return auth.SignJWT(claims(nil), "HS256", "unknown", hmacKey)
+		},
+		"wrong secret": func() (string, error) {
+			return auth.SignJWT(claims(nil), "HS256", "hs", []byte("wrong"))
+		},
+		"algorithm confusion": func() (string, error) {
+			return auth.SignJWT(claims(nil), "HS256", "rs", hmacKey)
+		},
+		"malformed": func() (string, error) {
+			return "not.a-token", nil
+		},
+	} {
+		token, err := token()
+		assert.NoError(t, err)
+		_, err = jwtConfig().ParseJWT(token)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestParseJWTLeeway(t *testing.T) {
+	token, _ := auth.SignJWT(claims(map[string]interface{}{"exp": now.Add(-30 * time.Second).Unix()}), "HS256", "hs", hmacKey)
+	_, err := jwtConfig().ParseJWT(token)
+	assert.NoError(t, err)
+}
+
+func TestJWTFilter(t *testing.T) {
+	f := auth.NewJWTFilter(jwtConfig())
+	token, _ := auth.SignJWT(claims(nil), "RS256", "rs", rsaKey)
+
+	req, w := newRequest("GET", "http://localhost/foo")
+	req.Header.Set("Authorization", "Bearer "+token)
+	p, err := serve(f, w, req)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", p.Name)
+	assert.Equal(t, "issuer", p.Claims["iss"])
+
+	req, w = newRequest("GET", "http://localhost/foo")
+	req.Header.Set("Authorization", "Bearer "+token+"x")
+	_, err = serve(f, w, req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+
+	req, w = newRequest("GET", "http://localhost/foo")
+	_, err = serve(f, w, req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+}
+
+func TestClientBearerFilter(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://localhost/foo", nil)
+	var authorization string
+	err := runClientFilter(auth.NewClientBearerFilter(func(ctx context.Context) (string, error) {
+		return "token", nil
+	}), req, func(r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "Bearer token", authorization)
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+)
+
+// Principal is the authenticated identity making the request.
+type Principal struct {
+	Name   string
+	Claims map[string]interface{}
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func GetPrincipal(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+func unauthorized(w http.ResponseWriter, challenge string) error {
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.WriteHeader(http.StatusUnauthorized)
+	return ErrUnauthorized
+}
+
+// NewAuthorizeFilter rejects requests without a principal with 401
+// Unauthorized and requests whose principal is not allowed with 403 Forbidden.
+func NewAuthorizeFilter(allow func(p *Principal, r *http.Request) bool) saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := httpservice.GetServerRequest(ctx)
+		p, ok := GetPrincipal(ctx)
+		if !ok {
+			req.Writer.WriteHeader(http.StatusUnauthorized)
+			return ErrUnauthorized
+		}
+		if !allow(p, req.Request) {
+			req.Writer.WriteHeader(http.StatusForbidden)
+			return ErrForbidden
+		}
+		return s.Do(ctx)
+	})
+}
+
+func setRequestHeader(ctx context.Context, name, value string) *http.Request {
+	cr := httpservice.GetClientRequest(ctx)
+	if cr.Request.Header == nil {
+		cr.Request.Header = make(http.Header)
+	}
+	cr.Request.Header.Set(name, value)
+	return cr.Request
+}
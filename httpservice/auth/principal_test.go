@@ -0,0 +1,51 @@
+package auth_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/httpservice/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRequest(method, url string) (*http.Request, *httptest.ResponseRecorder) {
+	req, _ := http.NewRequest(method, url, nil)
+	return req, httptest.NewRecorder()
+}
+
+// serve runs the filter and returns the principal seen by the service.
+func serve(f saola.Filter, w http.ResponseWriter, req *http.Request) (*auth.Principal, error) {
+	var principal *auth.Principal
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+	err := f.Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		principal, _ = auth.GetPrincipal(ctx)
+		return nil
+	}))
+	return principal, err
+}
+
+func TestAuthorizeFilter(t *testing.T) {
+	f := auth.NewAuthorizeFilter(func(p *auth.Principal, r *http.Request) bool {
+		return p.Name == "admin"
+	})
+
+	req, w := newRequest("GET", "http://localhost/foo")
+	_, err := serve(f, w, req)
+	assert.Equal(t, auth.ErrUnauthorized, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req, w = newRequest("GET", "http://localhost/foo")
+	ctx := auth.WithPrincipal(httpservice.WithServerRequest(context.Background(), w, req), &auth.Principal{Name: "bob"})
+	err = f.Do(ctx, saola.NoopService{})
+	assert.Equal(t, auth.ErrForbidden, err)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req, w = newRequest("GET", "http://localhost/foo")
+	ctx = auth.WithPrincipal(httpservice.WithServerRequest(context.Background(), w, req), &auth.Principal{Name: "admin"})
+	assert.NoError(t, f.Do(ctx, saola.NoopService{}))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
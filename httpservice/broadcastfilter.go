@@ -0,0 +1,59 @@
+package httpservice
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/arjantop/saola"
+)
+
+// BroadcastHeaderPrefix prefixes the headers carrying broadcast context values.
+const BroadcastHeaderPrefix = "Saola-Ctx-"
+
+// NewBroadcastFilter restores the broadcast context values sent by the caller.
+// Requests with malformed values are rejected with 400 Bad Request.
+func NewBroadcastFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetServerRequest(ctx)
+		marshalled := make(map[string][]byte)
+		for h, v := range req.Request.Header {
+			if !strings.HasPrefix(h, BroadcastHeaderPrefix) || len(v) == 0 {
+				continue
+			}
+			b, err := base64.URLEncoding.DecodeString(v[0])
+			if err != nil {
+				req.Writer.WriteHeader(http.StatusBadRequest)
+				return err
+			}
+			marshalled[h[len(BroadcastHeaderPrefix):]] = b
+		}
+		ctx, err := saola.UnmarshalBroadcast(ctx, marshalled)
+		if err != nil {
+			req.Writer.WriteHeader(http.StatusBadRequest)
+			return err
+		}
+		return s.Do(ctx)
+	})
+}
+
+// NewClientBroadcastFilter sends the broadcast context values to the server.
+func NewClientBroadcastFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		marshalled, err := saola.MarshalBroadcast(ctx)
+		if err != nil {
+			return err
+		}
+		if len(marshalled) != 0 {
+			cr := GetClientRequest(ctx)
+			if cr.Request.Header == nil {
+				cr.Request.Header = make(http.Header)
+			}
+			for name, b := range marshalled {
+				cr.Request.Header.Set(BroadcastHeaderPrefix+name, base64.URLEncoding.EncodeToString(b))
+			}
+		}
+		return s.Do(ctx)
+	})
+}
@@ -0,0 +1,47 @@
+package httpservice_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+var requestTenantKey = saola.NewBroadcastKey("httptest.tenant", saola.StringCodec{})
+
+func TestBroadcastFilterEndToEnd(t *testing.T) {
+	var tenant interface{}
+	server := saola.Apply(httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		tenant, _ = requestTenantKey.Value(ctx)
+		return nil
+	}), httpservice.NewBroadcastFilter())
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Do(httpservice.WithServerRequest(context.Background(), w, r))
+	}))
+	defer ts.Close()
+
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewClientBroadcastFilter(),
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := c.Do(requestTenantKey.WithValue(context.Background(), "acme"), req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "acme", tenant)
+}
+
+func TestBroadcastFilterMalformed(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.BroadcastHeaderPrefix+"httptest.tenant", "not base64!")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	err := httpservice.NewBroadcastFilter().Do(ctx, saola.NoopService{})
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
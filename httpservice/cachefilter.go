@@ -0,0 +1,386 @@
+package httpservice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/stats"
+)
+
+// revalidationTTL is how long the stale responses with validators are kept
+// to be revalidated with a conditional request.
+const revalidationTTL = time.Hour
+
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+}
+
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range h.Values("Cache-Control") {
+		for _, d := range strings.Split(v, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(d), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(value, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// lifetime returns how long the response is fresh. The store may be shared
+// so s-maxage takes precedence.
+func (cc cacheControl) lifetime(h http.Header, now time.Time) time.Duration {
+	if cc.has("no-cache") {
+		return 0
+	}
+	if d, ok := cc.seconds("s-maxage"); ok {
+		return d
+	}
+	if d, ok := cc.seconds("max-age"); ok {
+		return d
+	}
+	if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		return expires.Sub(date)
+	}
+	return 0
+}
+
+func hasValidators(h http.Header) bool {
+	return h.Get("ETag") != "" || h.Get("Last-Modified") != ""
+}
+
+func isConditional(req *http.Request) bool {
+	return req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != ""
+}
+
+// cacheTTL returns how long the response is stored, 0 when the response can
+// not be cached.
+func cacheTTL(req *http.Request, res *http.Response, now time.Time) time.Duration {
+	if !cacheableStatus[res.StatusCode] {
+		return 0
+	}
+	cc := parseCacheControl(res.Header)
+	if cc.has("no-store") || cc.has("private") {
+		return 0
+	}
+	for _, v := range res.Header.Values("Vary") {
+		if strings.Contains(v, "*") {
+			return 0
+		}
+	}
+	if req.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return 0
+	}
+	ttl := cc.lifetime(res.Header, now)
+	if swr, ok := cc.seconds("stale-while-revalidate"); ok {
+		ttl += swr
+	}
+	if hasValidators(res.Header) {
+		ttl += revalidationTTL
+	}
+	return ttl
+}
+
+func varyHeaders(req *http.Request, res *http.Response) http.Header {
+	vary := make(http.Header)
+	for _, v := range res.Header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				vary[http.CanonicalHeaderKey(name)] = req.Header.Values(name)
+			}
+		}
+	}
+	return vary
+}
+
+// variantKey returns the key of the response variant selected by the values
+// of the named request headers.
+func variantKey(key string, names []string, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range names {
+		b.WriteString("\n" + name + ": " + strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+func (r *CachedResponse) variants() []string {
+	names := make([]string, 0, len(r.Vary))
+	for name := range r.Vary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *CachedResponse) matches(req *http.Request) bool {
+	for name, values := range r.Vary {
+		if strings.Join(values, ",") != strings.Join(req.Header.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *CachedResponse) response(req *http.Request, age time.Duration) *http.Response {
+	header := r.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// responseDate returns the time the response was generated by the origin
+// from the Age header.
+func responseDate(h http.Header, now time.Time) time.Time {
+	age, err := strconv.ParseInt(h.Get("Age"), 10, 64)
+	if err != nil || age < 0 {
+		return now
+	}
+	return now.Add(-time.Duration(age) * time.Second)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type cache struct {
+	config       CacheConfig
+	revalidating sync.Map
+}
+
+// get returns the cached response for the request and the key it is stored
+// under, the responses with a Vary header are looked up by their variant.
+func (c *cache) get(ctx context.Context, key string, req *http.Request) (string, *CachedResponse, error) {
+	cached, err := c.config.Store.Get(ctx, key)
+	if err != nil || cached == nil || cached.Variants == nil {
+		return key, cached, err
+	}
+	key = variantKey(key, cached.Variants, req)
+	cached, err = c.config.Store.Get(ctx, key)
+	return key, cached, err
+}
+
+// fetch executes the request, conditional when the cached response is
+// revalidated, and stores the response when it is cacheable.
+func (c *cache) fetch(ctx context.Context, s saola.Service, stats stats.StatsReceiver, cr *ClientRequest, key string, cached *CachedResponse) error {
+	req := cr.Request
+	if cached != nil {
+		req = cloneRequest(req)
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := cached.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+	fetched := &ClientRequest{Request: req}
+	err := s.Do(withClientRequest(ctx, fetched))
+	res := fetched.Response
+	if err != nil || res == nil {
+		cr.Response = res
+		return err
+	}
+	now := time.Now()
+
+	if cached != nil && res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		updated := *cached
+		updated.Header = cached.Header.Clone()
+		for k, v := range res.Header {
+			if k != "Content-Length" {
+				updated.Header[k] = v
+			}
+		}
+		updated.Date = responseDate(res.Header, now)
+		stats.Counter("revalidated").Incr()
+		c.set(ctx, stats, key, cr.Request, &updated, now)
+		cr.Response = updated.response(cr.Request, now.Sub(updated.Date))
+		return nil
+	}
+
+	cr.Response = res
+	ttl := cacheTTL(cr.Request, res, now)
+	if ttl <= 0 || res.ContentLength > c.config.MaxBodySize {
+		return nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, c.config.MaxBodySize+1))
+	if err != nil {
+		res.Body.Close()
+		cr.Response = nil
+		return err
+	}
+	if int64(len(body)) > c.config.MaxBodySize {
+		// Too large to be cached, the rest of the body is streamed through.
+		stats.Counter("too_large").Incr()
+		res.Body = readCloser{io.MultiReader(bytes.NewReader(body), res.Body), res.Body}
+		return nil
+	}
+	res.Body.Close()
+	res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	c.set(ctx, stats, key, cr.Request, &CachedResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header.Clone(),
+		Body:       body,
+		Vary:       varyHeaders(cr.Request, res),
+		Date:       responseDate(res.Header, now),
+	}, now)
+	return nil
+}
+
+func (c *cache) set(ctx context.Context, stats stats.StatsReceiver, key string, req *http.Request, r *CachedResponse, now time.Time) {
+	ttl := cacheTTL(req, &http.Response{StatusCode: r.StatusCode, Header: r.Header}, now)
+	if ttl <= 0 {
+		return
+	}
+	if len(r.Vary) > 0 {
+		names := r.variants()
+		if err := c.config.Store.Set(ctx, key, &CachedResponse{Variants: names}, ttl); err != nil {
+			stats.Counter("store_errors").Incr()
+			return
+		}
+		key = variantKey(key, names, req)
+	}
+	if err := c.config.Store.Set(ctx, key, r, ttl); err != nil {
+		stats.Counter("store_errors").Incr()
+	}
+}
+
+// revalidateAsync revalidates the response in the background, at most once
+// at a time for each variant.
+func (c *cache) revalidateAsync(ctx context.Context, s saola.Service, stats stats.StatsReceiver, req *http.Request, key, variant string, cached *CachedResponse) {
+	if _, running := c.revalidating.LoadOrStore(variant, true); running {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		defer c.revalidating.Delete(variant)
+		cr := &ClientRequest{Request: cloneRequest(req)}
+		c.fetch(ctx, s, stats, cr, key, cached)
+		if cr.Response != nil {
+			cr.Response.Body.Close()
+		}
+	}()
+}
+
+type CacheConfig struct {
+	// Store of the cached responses.
+	Store CacheStore
+	// MaxBodySize is the largest response body that is cached, 1MB by
+	// default. Larger responses are passed through without being stored.
+	MaxBodySize int64
+}
+
+// NewCacheFilter caches the responses of GET requests made through a Client
+// in the store as allowed by their Cache-Control, Expires and Vary headers.
+// Stale responses are revalidated with conditional requests using their ETag
+// and Last-Modified headers, in the background when they are still within
+// stale-while-revalidate. Requests with no-store or conditional headers
+// bypass the cache and no-cache forces the revalidation.
+func NewCacheFilter(config CacheConfig, stats stats.StatsReceiver) saola.Filter {
+	if config.MaxBodySize == 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	c := &cache{config: config}
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		cr := GetClientRequest(ctx)
+		req := cr.Request
+		if req.Method != "GET" || (req.Body != nil && req.Body != http.NoBody) || isConditional(req) {
+			return s.Do(ctx)
+		}
+		reqCC := parseCacheControl(req.Header)
+		if reqCC.has("no-store") {
+			return s.Do(ctx)
+		}
+
+		cacheStats := stats.Scope(s.Name()).Scope("cache")
+		key := req.URL.String()
+		variant, cached, err := c.get(ctx, key, req)
+		if err != nil {
+			cacheStats.Counter("store_errors").Incr()
+			cached = nil
+		}
+		if cached == nil || !cached.matches(req) {
+			cacheStats.Counter("miss").Incr()
+			return c.fetch(ctx, s, cacheStats, cr, key, nil)
+		}
+
+		now := time.Now()
+		age := now.Sub(cached.Date)
+		cc := parseCacheControl(cached.Header)
+		lifetime := cc.lifetime(cached.Header, now)
+		if maxAge, ok := reqCC.seconds("max-age"); ok && maxAge < lifetime {
+			lifetime = maxAge
+		}
+		if !reqCC.has("no-cache") {
+			if age < lifetime {
+				cacheStats.Counter("hit").Incr()
+				cr.Response = cached.response(req, age)
+				return nil
+			}
+			swr, _ := cc.seconds("stale-while-revalidate")
+			if age < lifetime+swr && !cc.has("must-revalidate") {
+				cacheStats.Counter("stale").Incr()
+				c.revalidateAsync(ctx, s, cacheStats, req, key, variant, cached)
+				cr.Response = cached.response(req, age)
+				return nil
+			}
+		}
+		if !hasValidators(cached.Header) {
+			cacheStats.Counter("miss").Incr()
+			cached = nil
+		}
+		return c.fetch(ctx, s, cacheStats, cr, key, cached)
+	})
+}
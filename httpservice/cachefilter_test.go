@@ -0,0 +1,257 @@
+package httpservice_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/stats/statstest"
+	"github.com/stretchr/testify/assert"
+)
+
+type cachingClient struct {
+	*httpservice.Client
+	server   *httptest.Server
+	stats    *statstest.StatsRecorder
+	requests int32
+}
+
+// newCachingClient returns a client caching the responses of the handler,
+// called with the number of the request.
+func newCachingClient(handler func(w http.ResponseWriter, r *http.Request, n int32)) *cachingClient {
+	c := &cachingClient{stats: statstest.NewRecorder()}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r, atomic.AddInt32(&c.requests, 1))
+	}))
+	c.Client = &httpservice.Client{
+		Transport: &http.Transport{},
+		Filter: httpservice.NewCacheFilter(httpservice.CacheConfig{
+			Store: httpservice.NewLRUCacheStore(1 << 20),
+		}, c.stats),
+	}
+	return c
+}
+
+func (c *cachingClient) Requests() int32 {
+	return atomic.LoadInt32(&c.requests)
+}
+
+func (c *cachingClient) get(t *testing.T, method string, header http.Header) (*http.Response, string) {
+	req, err := http.NewRequest(method, c.server.URL+"/foo", nil)
+	assert.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := c.Do(context.Background(), req)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	return res, string(body)
+}
+
+func writeCount(w http.ResponseWriter, n int32) {
+	w.Write([]byte(strconv.Itoa(int(n))))
+}
+
+func TestCacheFilterFresh(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	for i := 0; i < 3; i++ {
+		res, body := c.get(t, "GET", nil)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "1", body)
+	}
+	assert.Equal(t, int32(1), c.Requests())
+	assert.Equal(t, int64(1), c.stats.CounterValue("func.cache.miss"))
+	assert.Equal(t, int64(2), c.stats.CounterValue("func.cache.hit"))
+}
+
+func TestCacheFilterNotCacheable(t *testing.T) {
+	for _, cc := range []string{"no-store", "private, max-age=60", ""} {
+		c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+			w.Header().Set("Cache-Control", cc)
+			writeCount(w, n)
+		})
+		c.get(t, "GET", nil)
+		_, body := c.get(t, "GET", nil)
+		assert.Equal(t, "2", body, cc)
+		c.server.Close()
+	}
+}
+
+func TestCacheFilterBypass(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	c.get(t, "GET", nil)
+	_, body := c.get(t, "POST", nil)
+	assert.Equal(t, "2", body)
+	_, body = c.get(t, "GET", http.Header{"Cache-Control": {"no-store"}})
+	assert.Equal(t, "3", body)
+	_, body = c.get(t, "GET", http.Header{"Cache-Control": {"max-age=0"}})
+	assert.Equal(t, "4", body)
+	_, body = c.get(t, "GET", nil)
+	assert.Equal(t, "4", body)
+}
+
+func TestCacheFilterRevalidate(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	c.get(t, "GET", nil)
+	res, body := c.get(t, "GET", nil)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "1", body)
+	assert.Equal(t, int32(2), c.Requests())
+	assert.Equal(t, int64(1), c.stats.CounterValue("func.cache.revalidated"))
+}
+
+func TestCacheFilterLastModified(t *testing.T) {
+	modified := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("Last-Modified", modified)
+		if r.Header.Get("If-Modified-Since") == modified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	c.get(t, "GET", nil)
+	_, body := c.get(t, "GET", nil)
+	assert.Equal(t, "1", body)
+	assert.Equal(t, int64(1), c.stats.CounterValue("func.cache.revalidated"))
+}
+
+func TestCacheFilterStaleWhileRevalidate(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=60")
+		if n == 1 {
+			w.Header().Set("Age", "20")
+		}
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	c.get(t, "GET", nil)
+	res, body := c.get(t, "GET", nil)
+	assert.Equal(t, "1", body, "stale response should be served")
+	assert.Equal(t, "20", res.Header.Get("Age"))
+	assert.Equal(t, int64(1), c.stats.CounterValue("func.cache.stale"))
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, body := c.get(t, "GET", nil); body == "2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("response should be revalidated in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, int32(2), c.Requests())
+}
+
+func TestCacheFilterMustRevalidate(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=10, stale-while-revalidate=60, must-revalidate")
+		w.Header().Set("Age", "20")
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	c.get(t, "GET", nil)
+	_, body := c.get(t, "GET", nil)
+	assert.Equal(t, "2", body)
+}
+
+func TestCacheFilterVary(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	c.get(t, "GET", http.Header{"Accept-Language": {"en"}})
+	_, body := c.get(t, "GET", http.Header{"Accept-Language": {"en"}})
+	assert.Equal(t, "1", body)
+	_, body = c.get(t, "GET", http.Header{"Accept-Language": {"de"}})
+	assert.Equal(t, "2", body)
+	_, body = c.get(t, "GET", http.Header{"Accept-Language": {"en"}})
+	assert.Equal(t, "1", body, "variants should be cached separately")
+	_, body = c.get(t, "GET", http.Header{"Accept-Language": {"de"}})
+	assert.Equal(t, "2", body)
+	assert.Equal(t, int32(2), c.Requests())
+}
+
+func TestCacheFilterMaxBodySize(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		if r.URL.Query().Get("stream") != "" {
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("large body " + strconv.Itoa(int(n))))
+	})
+	defer c.server.Close()
+	c.Filter = httpservice.NewCacheFilter(httpservice.CacheConfig{
+		Store:       httpservice.NewLRUCacheStore(1 << 20),
+		MaxBodySize: 8,
+	}, c.stats)
+
+	_, body := c.get(t, "GET", nil)
+	assert.Equal(t, "large body 1", body)
+	_, body = c.get(t, "GET", nil)
+	assert.Equal(t, "large body 2", body, "response larger than the limit should not be cached")
+
+	req, _ := http.NewRequest("GET", c.server.URL+"/foo?stream=1", nil)
+	for i := 3; i <= 4; i++ {
+		res, err := c.Do(context.Background(), req)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-1), res.ContentLength)
+		content, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "large body "+strconv.Itoa(i), string(content), "streamed body should be passed through")
+	}
+	assert.Equal(t, int64(2), c.stats.CounterValue("func.cache.too_large"))
+}
+
+func TestCacheFilterAuthorization(t *testing.T) {
+	c := newCachingClient(func(w http.ResponseWriter, r *http.Request, n int32) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		writeCount(w, n)
+	})
+	defer c.server.Close()
+
+	auth := http.Header{"Authorization": {"Bearer token"}}
+	c.get(t, "GET", auth)
+	_, body := c.get(t, "GET", auth)
+	assert.Equal(t, "2", body, "authorized responses should not be shared")
+}
@@ -0,0 +1,116 @@
+package httpservice
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// CachedResponse is a response stored by the cache filter.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Vary are the values of the request headers listed in the Vary header of
+	// the response.
+	Vary http.Header
+	// Date is the time the response was generated, its age is the time passed
+	// since.
+	Date time.Time
+	// Variants is only set on the entry stored under the key of the responses
+	// with a Vary header. It lists the request headers selecting the variant,
+	// each variant is stored under its own key.
+	Variants []string
+}
+
+// size approximates the memory used by the response.
+func (r *CachedResponse) size() int64 {
+	n := len(r.Body)
+	for _, h := range []http.Header{r.Header, r.Vary} {
+		for k, values := range h {
+			n += len(k)
+			for _, v := range values {
+				n += len(v)
+			}
+		}
+	}
+	for _, v := range r.Variants {
+		n += len(v)
+	}
+	return int64(n)
+}
+
+// CacheStore stores the cached responses. Get returns nil when the response
+// is not stored or has expired.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (*CachedResponse, error)
+	Set(ctx context.Context, key string, r *CachedResponse, ttl time.Duration) error
+}
+
+type lruEntry struct {
+	key      string
+	response *CachedResponse
+	size     int64
+	expires  time.Time
+}
+
+type lruCacheStore struct {
+	lock     sync.Mutex
+	maxBytes int64
+	bytes    int64
+	entries  map[string]*list.Element
+	order    *list.List
+}
+
+// NewLRUCacheStore stores the responses in memory up to about maxBytes,
+// evicting the least recently used.
+func NewLRUCacheStore(maxBytes int64) CacheStore {
+	return &lruCacheStore{
+		maxBytes: maxBytes,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (s *lruCacheStore) remove(el *list.Element) {
+	e := el.Value.(*lruEntry)
+	s.order.Remove(el)
+	delete(s.entries, e.key)
+	s.bytes -= e.size
+}
+
+func (s *lruCacheStore) Get(ctx context.Context, key string) (*CachedResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		s.remove(el)
+		return nil, nil
+	}
+	s.order.MoveToFront(el)
+	return e.response, nil
+}
+
+func (s *lruCacheStore) Set(ctx context.Context, key string, r *CachedResponse, ttl time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if el, ok := s.entries[key]; ok {
+		s.remove(el)
+	}
+	e := &lruEntry{key, r, int64(len(key)) + r.size(), time.Now().Add(ttl)}
+	if e.size > s.maxBytes {
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(e)
+	s.bytes += e.size
+	for s.bytes > s.maxBytes {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
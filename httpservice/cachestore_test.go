@@ -0,0 +1,58 @@
+package httpservice_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func cachedResponse(body string) *httpservice.CachedResponse {
+	return &httpservice.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {`"v1"`}},
+		Body:       []byte(body),
+		Date:       time.Now().Round(time.Second).UTC(),
+	}
+}
+
+func TestLRUCacheStore(t *testing.T) {
+	ctx := context.Background()
+	// Each entry takes 10 bytes: the key, body and header.
+	s := httpservice.NewLRUCacheStore(20)
+	s.Set(ctx, "a", cachedResponse("a"), time.Minute)
+	s.Set(ctx, "b", cachedResponse("b"), time.Minute)
+	r, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), r.Body)
+
+	s.Set(ctx, "c", cachedResponse("c"), time.Minute)
+	r, _ = s.Get(ctx, "b")
+	assert.Nil(t, r, "least recently used response should be evicted")
+	r, _ = s.Get(ctx, "a")
+	assert.NotNil(t, r)
+}
+
+func TestLRUCacheStoreTooLarge(t *testing.T) {
+	ctx := context.Background()
+	s := httpservice.NewLRUCacheStore(20)
+	s.Set(ctx, "a", cachedResponse("a"), time.Minute)
+	s.Set(ctx, "b", cachedResponse("a body larger than the store"), time.Minute)
+	r, _ := s.Get(ctx, "b")
+	assert.Nil(t, r)
+	r, _ = s.Get(ctx, "a")
+	assert.NotNil(t, r, "too large response should not evict the others")
+}
+
+func TestLRUCacheStoreExpired(t *testing.T) {
+	ctx := context.Background()
+	s := httpservice.NewLRUCacheStore(20)
+	s.Set(ctx, "a", cachedResponse("a"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	r, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+}
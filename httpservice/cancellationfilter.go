@@ -1,28 +1,22 @@
 package httpservice
 
 import (
-	"net/http"
+	"context"
 
 	"github.com/arjantop/saola"
-	"golang.org/x/net/context"
 )
 
+// NewCancellationFilter cancels the context when the context of the server
+// request is done, e.g. when the client closes the connection. Contexts
+// created by Endpoint and Serve are already derived from the request so the
+// filter is only needed for services invoked with an unrelated context.
 func NewCancellationFilter() saola.Filter {
 	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
 		req := GetServerRequest(ctx)
-		if w, ok := req.Writer.(http.CloseNotifier); ok {
-			ctx, cancel := context.WithCancel(ctx)
-			defer cancel()
-			go func() {
-				select {
-				case <-w.CloseNotify():
-					cancel()
-				case <-ctx.Done():
-					return
-				}
-			}()
-			return s.Do(ctx)
-		}
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stop := context.AfterFunc(req.Request.Context(), cancel)
+		defer stop()
 		return s.Do(ctx)
 	})
 }
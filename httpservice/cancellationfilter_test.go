@@ -1,12 +1,14 @@
 package httpservice_test
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/arjantop/saola/httpservice"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 type SleepService struct{}
@@ -25,9 +27,10 @@ func (s SleepService) Name() string {
 }
 
 func TestCancellationFilter_RequestInCancelled(t *testing.T) {
-	w := NewClosableResponseWriter()
-	ctx := httpservice.WithServerRequest(context.Background(), w, nil)
-	go func() { w.Close() }()
+	rctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	ctx := httpservice.WithServerRequest(context.Background(), httptest.NewRecorder(), req.WithContext(rctx))
+	go cancel()
 	err := httpservice.NewCancellationFilter().Do(ctx, SleepService{})
 	assert.Equal(t, context.Canceled, err)
 }
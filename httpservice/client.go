@@ -1,17 +1,14 @@
 package httpservice
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/arjantop/saola"
-	"golang.org/x/net/context"
 )
 
-type CancellableRoundTripper interface {
-	http.RoundTripper
-	CancelRequest(*http.Request)
-}
-
 type ClientRequest struct {
 	Request  *http.Request
 	Response *http.Response
@@ -30,20 +27,79 @@ func GetClientRequest(ctx context.Context) *ClientRequest {
 	panic("missing client request")
 }
 
-type Client struct {
-	Filter    saola.Filter
-	service   saola.Service
-	Transport CancellableRoundTripper
+type ResponseClass int
+
+const (
+	Success ResponseClass = iota
+	RetryableFailure
+	NonRetryableFailure
+)
+
+// ResponseClassifier decides which responses are failures of the request.
+type ResponseClassifier func(res *http.Response) ResponseClass
+
+// ServerErrorClassifier classifies 5xx responses as retryable failures.
+func ServerErrorClassifier(res *http.Response) ResponseClass {
+	if res.StatusCode >= 500 {
+		return RetryableFailure
+	}
+	return Success
 }
 
-type result struct {
-	Response *http.Response
-	Error    error
+// StatusClassifier classifies 5xx and 429 responses as retryable failures and
+// the other 4xx responses as non-retryable failures.
+func StatusClassifier(res *http.Response) ResponseClass {
+	switch {
+	case res.StatusCode >= 500 || res.StatusCode == http.StatusTooManyRequests:
+		return RetryableFailure
+	case res.StatusCode >= 400:
+		return NonRetryableFailure
+	}
+	return Success
+}
+
+// ResponseError is returned for responses classified as failures. The
+// response is still available and its body must be closed by the caller.
+type ResponseError struct {
+	Response  *http.Response
+	Retryable bool
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("http response: %s", e.Response.Status)
+}
+
+// IsRetryable reports whether a request that failed with the error can be
+// retried. Transport errors are retryable, cancellation is not. An HttpError
+// that does not wrap a classified response is retryable when the
+// StatusClassifier classifies its status code so.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var resErr *ResponseError
+	if errors.As(err, &resErr) {
+		return resErr.Retryable
+	}
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return StatusClassifier(&http.Response{StatusCode: httpErr.StatusCode}) == RetryableFailure
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+type Client struct {
+	Filter  saola.Filter
+	service saola.Service
+	// Classifier turns responses into errors, all the responses are
+	// successful when nil.
+	Classifier ResponseClassifier
+	Transport  http.RoundTripper
 }
 
 func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, error) {
 	if c.service == nil {
-		s := newClientService(c.Transport)
+		s := newClientService(c.Transport, c.Classifier)
 		if c.Filter != nil {
 			c.service = saola.Apply(s, c.Filter)
 		} else {
@@ -55,23 +111,27 @@ func (c *Client) Do(ctx context.Context, req *http.Request) (*http.Response, err
 	return cr.Response, err
 }
 
-func newClientService(tr CancellableRoundTripper) saola.Service {
+func newClientService(tr http.RoundTripper, classifier ResponseClassifier) saola.Service {
 	client := http.Client{Transport: tr}
 	return saola.FuncService(func(ctx context.Context) error {
 		cr := GetClientRequest(ctx)
-		r := make(chan result, 1)
-		go func() {
-			resp, err := client.Do(cr.Request)
-			r <- result{resp, err}
-		}()
-		select {
-		case <-ctx.Done():
-			tr.CancelRequest(cr.Request)
-			<-r
-			return ctx.Err()
-		case result := <-r:
-			cr.Response = result.Response
-			return result.Error
+		resp, err := client.Do(cr.Request.WithContext(ctx))
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		cr.Response = resp
+		if classifier == nil {
+			return nil
+		}
+		switch classifier(resp) {
+		case RetryableFailure:
+			return &ResponseError{resp, true}
+		case NonRetryableFailure:
+			return &ResponseError{resp, false}
 		}
+		return nil
 	})
 }
@@ -2,6 +2,9 @@ package httpservice_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -10,8 +13,8 @@ import (
 
 	"github.com/arjantop/saola"
 	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/stats/statstest"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func NewServer() *httptest.Server {
@@ -169,3 +172,80 @@ func BenchmarkClientStandardWithTimeout(b *testing.B) {
 		res.Body.Close()
 	}
 }
+
+func TestClientClassifier(t *testing.T) {
+	ts := NewServer()
+	defer ts.Close()
+	r := statstest.NewRecorder()
+	c := httpservice.Client{
+		Transport:  &http.Transport{},
+		Classifier: httpservice.StatusClassifier,
+		Filter:     saola.NewStatsFilter(r),
+	}
+	req, err := http.NewRequest("GET", ts.URL+"/missing", nil)
+	assert.NoError(t, err)
+	res, err := c.Do(context.Background(), req)
+	assert.Error(t, err)
+	assert.False(t, httpservice.IsRetryable(err))
+	assert.Equal(t, http.StatusNotFound, res.StatusCode, "response should still be available")
+	res.Body.Close()
+	respErr, ok := err.(*httpservice.ResponseError)
+	assert.True(t, ok)
+	assert.Equal(t, res, respErr.Response)
+	assert.Equal(t, int64(1), r.CounterValue("func.failure"))
+
+	req, err = http.NewRequest("GET", ts.URL+"/foo", nil)
+	assert.NoError(t, err)
+	res, err = c.Do(context.Background(), req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, int64(1), r.CounterValue("func.success"))
+}
+
+func TestResponseClassifiers(t *testing.T) {
+	for code, expected := range map[int][2]httpservice.ResponseClass{
+		200: {httpservice.Success, httpservice.Success},
+		304: {httpservice.Success, httpservice.Success},
+		404: {httpservice.Success, httpservice.NonRetryableFailure},
+		429: {httpservice.Success, httpservice.RetryableFailure},
+		503: {httpservice.RetryableFailure, httpservice.RetryableFailure},
+	} {
+		res := &http.Response{StatusCode: code}
+		assert.Equal(t, expected[0], httpservice.ServerErrorClassifier(res), code)
+		assert.Equal(t, expected[1], httpservice.StatusClassifier(res), code)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.False(t, httpservice.IsRetryable(nil))
+	assert.False(t, httpservice.IsRetryable(context.Canceled))
+	assert.True(t, httpservice.IsRetryable(errors.New("connection refused")))
+	assert.True(t, httpservice.IsRetryable(&httpservice.ResponseError{Retryable: true}))
+	assert.False(t, httpservice.IsRetryable(&httpservice.ResponseError{Retryable: false}))
+	assert.False(t, httpservice.IsRetryable(fmt.Errorf("call: %w", context.DeadlineExceeded)))
+	assert.False(t, httpservice.IsRetryable(httpservice.NewHttpError(http.StatusBadRequest, "bad request")))
+	assert.True(t, httpservice.IsRetryable(httpservice.NewHttpError(http.StatusServiceUnavailable, "unavailable")))
+}
+
+func TestClientDoCancelled(t *testing.T) {
+	block := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer ts.Close()
+	defer close(block)
+
+	c := httpservice.Client{
+		Transport: http.DefaultTransport,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := c.Do(ctx, req)
+	assert.Nil(t, res)
+	assert.Equal(t, context.Canceled, err)
+	assert.Nil(t, req.Context().Err(), "original request should not be modified")
+}
@@ -0,0 +1,324 @@
+package httpservice
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/arjantop/saola"
+)
+
+// Compressor creates writers for a content coding, e.g. "gzip". Codings that
+// are not part of the standard library (like brotli) can be added by wrapping
+// their writers.
+type Compressor struct {
+	Encoding  string
+	NewWriter func(w io.Writer) io.WriteCloser
+}
+
+var GzipCompressor = Compressor{"gzip", func(w io.Writer) io.WriteCloser {
+	return gzip.NewWriter(w)
+}}
+
+var DeflateCompressor = Compressor{"deflate", func(w io.Writer) io.WriteCloser {
+	return zlib.NewWriter(w)
+}}
+
+type CompressionConfig struct {
+	// Compressors in the order of preference, gzip and deflate by default.
+	Compressors []Compressor
+	// MinSize is the minimum size of the response body to be compressed.
+	MinSize int
+	// ContentTypes allowed to be compressed. Entries ending with "/" match
+	// all the subtypes.
+	ContentTypes []string
+}
+
+var DefaultCompressionConfig = CompressionConfig{
+	Compressors: []Compressor{GzipCompressor, DeflateCompressor},
+	MinSize:     1024,
+	ContentTypes: []string{
+		"text/",
+		"application/json",
+		"application/javascript",
+		"application/xml",
+		"image/svg+xml",
+	},
+}
+
+func (c CompressionConfig) allowed(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.ContentTypes {
+		if t == mediaType || (strings.HasSuffix(t, "/") && strings.HasPrefix(mediaType, t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate selects the compressor with the highest quality value in the
+// Accept-Encoding header, the preferred one when tied. The quality value of *
+// only applies to the codings that are not listed.
+func (c CompressionConfig) negotiate(acceptEncoding string) (Compressor, bool) {
+	qs := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, q := parseCoding(part)
+		qs[coding] = q
+	}
+	var selected Compressor
+	var selectedQ float64
+	for _, comp := range c.Compressors {
+		q, ok := qs[comp.Encoding]
+		if !ok {
+			q = qs["*"]
+		}
+		if q > selectedQ {
+			selected, selectedQ = comp, q
+		}
+	}
+	return selected, selectedQ > 0
+}
+
+func parseCoding(s string) (string, float64) {
+	params := strings.Split(s, ";")
+	coding := strings.ToLower(strings.TrimSpace(params[0]))
+	q := 1.0
+	for _, p := range params[1:] {
+		p = strings.TrimSpace(p)
+		if strings.HasPrefix(p, "q=") {
+			if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return coding, q
+}
+
+type compressWriter struct {
+	http.ResponseWriter
+	config     CompressionConfig
+	compressor Compressor
+
+	statusCode  int
+	buf         bytes.Buffer
+	decided     bool
+	compressing io.WriteCloser
+	hijacked    bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.statusCode == 0 {
+		w.statusCode = code
+	}
+}
+
+func (w *compressWriter) StatusCode() int {
+	if w.statusCode == 0 {
+		return http.StatusOK
+	}
+	return w.statusCode
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.compressing != nil {
+			return w.compressing.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+	w.buf.Write(b)
+	if w.buf.Len() >= w.config.MinSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide starts the response either compressed or not once enough of the body
+// is known.
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && w.buf.Len() != 0 {
+		h.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+	code := w.StatusCode()
+	compressible := code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && w.config.allowed(h.Get("Content-Type"))
+	if compressible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+	if compressible && compress {
+		h.Set("Content-Encoding", w.compressor.Encoding)
+		h.Del("Content-Length")
+		w.ResponseWriter.WriteHeader(code)
+		w.compressing = w.compressor.NewWriter(w.ResponseWriter)
+		_, err := w.compressing.Write(w.buf.Bytes())
+		return err
+	}
+	w.ResponseWriter.WriteHeader(code)
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+type flusher interface {
+	Flush() error
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if f, ok := w.compressing.(flusher); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) CloseNotify() <-chan bool {
+	if n, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return n.CloseNotify()
+	}
+	c := make(chan bool)
+	return c
+}
+
+func (w *compressWriter) SetRoute(route string) {
+	if ri, ok := w.ResponseWriter.(RouteInterceptor); ok {
+		ri.SetRoute(route)
+	}
+}
+
+func (w *compressWriter) Route() string {
+	if ri, ok := w.ResponseWriter.(RouteInterceptor); ok {
+		return ri.Route()
+	}
+	return ""
+}
+
+// BytesWritten returns the number of the compressed bytes written.
+func (w *compressWriter) BytesWritten() int64 {
+	if bi, ok := w.ResponseWriter.(BytesWrittenInterceptor); ok {
+		return bi.BytesWritten()
+	}
+	return 0
+}
+
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := h.Hijack()
+		if err == nil {
+			w.hijacked = true
+		}
+		return conn, rw, err
+	}
+	return nil, nil, errHijackNotSupported
+}
+
+func (w *compressWriter) Close() error {
+	if w.hijacked {
+		return nil
+	}
+	if !w.decided {
+		if err := w.decide(w.buf.Len() >= w.config.MinSize); err != nil {
+			return err
+		}
+	}
+	if w.compressing != nil {
+		return w.compressing.Close()
+	}
+	return nil
+}
+
+// NewCompressionFilter compresses the responses with the coding negotiated
+// through the Accept-Encoding header.
+func NewCompressionFilter(config CompressionConfig) saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetServerRequest(ctx)
+		compressor, ok := config.negotiate(req.Request.Header.Get("Accept-Encoding"))
+		if !ok || req.Request.Method == "HEAD" {
+			return s.Do(ctx)
+		}
+		w := &compressWriter{
+			ResponseWriter: req.Writer,
+			config:         config,
+			compressor:     compressor,
+		}
+		err := s.Do(WithServerRequest(ctx, w, req.Request))
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	})
+}
+
+type decompressReadCloser struct {
+	io.Reader
+	body io.ReadCloser
+}
+
+func (r decompressReadCloser) Close() error {
+	return r.body.Close()
+}
+
+// NewClientCompressionFilter advertises support for gzip and deflate and
+// transparently decodes the compressed responses.
+func NewClientCompressionFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		cr := GetClientRequest(ctx)
+		if cr.Request.Header == nil {
+			cr.Request.Header = make(http.Header)
+		}
+		if cr.Request.Header.Get("Accept-Encoding") != "" {
+			return s.Do(ctx)
+		}
+		cr.Request.Header.Set("Accept-Encoding", "gzip, deflate")
+		// Failures classified by the client carry the response too.
+		err := s.Do(ctx)
+		res := cr.Response
+		if res == nil || !responseHasBody(cr.Request, res) {
+			return err
+		}
+		var reader io.Reader
+		var derr error
+		switch strings.ToLower(res.Header.Get("Content-Encoding")) {
+		case "gzip":
+			reader, derr = gzip.NewReader(res.Body)
+		case "deflate":
+			reader, derr = zlib.NewReader(res.Body)
+		default:
+			return err
+		}
+		if derr != nil {
+			res.Body.Close()
+			cr.Response = nil
+			return derr
+		}
+		res.Body = decompressReadCloser{reader, res.Body}
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Uncompressed = true
+		return err
+	})
+}
+
+// responseHasBody reports whether the response can have a body to decode.
+func responseHasBody(req *http.Request, res *http.Response) bool {
+	return req.Method != "HEAD" && res.StatusCode != http.StatusNoContent &&
+		res.StatusCode != http.StatusNotModified && res.ContentLength != 0
+}
@@ -0,0 +1,221 @@
+package httpservice_test
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+var largeBody = strings.Repeat("hello world ", 200)
+
+func compressedResponse(acceptEncoding, contentType, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+	s := saola.Apply(httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		if contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write([]byte(body))
+		return nil
+	}), httpservice.NewCompressionFilter(httpservice.DefaultCompressionConfig))
+	s.Do(ctx)
+	return w
+}
+
+func TestCompressionFilterGzip(t *testing.T) {
+	w := compressedResponse("deflate;q=0.5, gzip", "text/plain", largeBody)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	r, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, largeBody, string(content))
+}
+
+func TestCompressionFilterDeflate(t *testing.T) {
+	w := compressedResponse("gzip;q=0.5, deflate", "application/json; charset=utf-8", largeBody)
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	r, err := zlib.NewReader(w.Body)
+	assert.NoError(t, err)
+	content, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, largeBody, string(content))
+}
+
+func TestCompressionFilterSmallBody(t *testing.T) {
+	w := compressedResponse("gzip", "text/plain", "hello")
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, "hello", w.Body.String())
+}
+
+func TestCompressionFilterContentType(t *testing.T) {
+	w := compressedResponse("gzip", "image/png", largeBody)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, largeBody, w.Body.String())
+}
+
+func TestCompressionFilterDetectContentType(t *testing.T) {
+	w := compressedResponse("gzip", "", largeBody)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "text/plain; charset=utf-8", w.Header().Get("Content-Type"))
+}
+
+func TestCompressionFilterNotAccepted(t *testing.T) {
+	w := compressedResponse("br, gzip;q=0", "text/plain", largeBody)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "", w.Header().Get("Vary"))
+	assert.Equal(t, largeBody, w.Body.String())
+}
+
+func TestCompressionFilterWildcard(t *testing.T) {
+	w := compressedResponse("*", "text/plain", largeBody)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	w = compressedResponse("gzip;q=0, *;q=1", "text/plain", largeBody)
+	assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	w = compressedResponse("gzip;q=0, deflate;q=0, *", "text/plain", largeBody)
+	assert.Equal(t, "", w.Header().Get("Content-Encoding"))
+}
+
+func TestCompressionFilterInterceptors(t *testing.T) {
+	w := httpservice.NewResponseWriter(httptest.NewRecorder())
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+	s := saola.Apply(httpservice.FuncService(func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+		rw.(httpservice.RouteInterceptor).SetRoute("/foo")
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.Write([]byte(largeBody))
+		assert.True(t, rw.(httpservice.BytesWrittenInterceptor).BytesWritten() > 0)
+		_, _, err := rw.(http.Hijacker).Hijack()
+		assert.Error(t, err, "recorder can not be hijacked")
+		return nil
+	}), httpservice.NewCompressionFilter(httpservice.DefaultCompressionConfig))
+	assert.NoError(t, s.Do(ctx))
+	assert.Equal(t, "/foo", w.Route())
+	assert.True(t, w.BytesWritten() < int64(len(largeBody)))
+}
+
+func TestCompressionFilterStatusCode(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+	s := saola.Apply(httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(largeBody))
+		return nil
+	}), httpservice.NewCompressionFilter(httpservice.DefaultCompressionConfig))
+	assert.NoError(t, s.Do(ctx))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+}
+
+func TestCompressionFilterFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+	s := saola.Apply(httpservice.FuncService(func(ctx context.Context, rw http.ResponseWriter, r *http.Request) error {
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.Write([]byte("hello"))
+		rw.(http.Flusher).Flush()
+		assert.True(t, w.Flushed)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		return nil
+	}), httpservice.NewCompressionFilter(httpservice.DefaultCompressionConfig))
+	assert.NoError(t, s.Do(ctx))
+}
+
+func TestClientCompressionFilter(t *testing.T) {
+	server := saola.Apply(httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(largeBody))
+		return nil
+	}), httpservice.NewCompressionFilter(httpservice.CompressionConfig{
+		Compressors:  []httpservice.Compressor{httpservice.DeflateCompressor},
+		ContentTypes: []string{"text/"},
+	}))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Do(httpservice.WithServerRequest(context.Background(), w, r))
+	}))
+	defer ts.Close()
+
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewClientCompressionFilter(),
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := c.Do(context.Background(), req)
+	assert.NoError(t, err)
+	assert.True(t, res.Uncompressed)
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, largeBody, string(content))
+}
+
+func TestClientCompressionFilterNoBody(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		if r.URL.Path == "/empty" {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer ts.Close()
+
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewClientCompressionFilter(),
+	}
+	for _, r := range []struct{ method, path string }{{"HEAD", "/"}, {"GET", "/empty"}} {
+		req, _ := http.NewRequest(r.method, ts.URL+r.path, nil)
+		res, err := c.Do(context.Background(), req)
+		if assert.NoError(t, err, r.method) {
+			assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+			res.Body.Close()
+		}
+	}
+}
+
+func TestClientCompressionFilterResponseError(t *testing.T) {
+	server := saola.Apply(httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(largeBody))
+		return nil
+	}), httpservice.NewCompressionFilter(httpservice.DefaultCompressionConfig))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.Do(httpservice.WithServerRequest(context.Background(), w, r))
+	}))
+	defer ts.Close()
+
+	c := httpservice.Client{
+		Transport:  &http.Transport{},
+		Filter:     httpservice.NewClientCompressionFilter(),
+		Classifier: httpservice.StatusClassifier,
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	_, err := c.Do(context.Background(), req)
+	resErr, ok := err.(*httpservice.ResponseError)
+	if !assert.True(t, ok) {
+		t.FailNow()
+	}
+	assert.True(t, resErr.Response.Uncompressed)
+	content, err := ioutil.ReadAll(resErr.Response.Body)
+	resErr.Response.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, largeBody, string(content))
+}
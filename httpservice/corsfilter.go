@@ -0,0 +1,176 @@
+package httpservice
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/arjantop/saola"
+)
+
+type CORSConfig struct {
+	// AllowedOrigins are matched exactly, "*" allows all the origins and a
+	// single wildcard matches a part of the origin, e.g.
+	// "https://*.example.com".
+	AllowedOrigins []string
+	// AllowOrigin is consulted for origins not in AllowedOrigins.
+	AllowOrigin func(origin string) bool
+	// AllowedMethods default to GET, HEAD and POST.
+	AllowedMethods []string
+	// AllowedHeaders may contain "*" to allow all the headers.
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// AllowCredentials allows credentialed requests from the origins allowed
+	// by a pattern other than "*" or by AllowOrigin. The origins allowed
+	// only by "*" get responses without credentials.
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" || pattern == origin {
+		return true
+	}
+	if i := strings.IndexByte(pattern, '*'); i >= 0 {
+		prefix, suffix := pattern[:i], pattern[i+1:]
+		return len(origin) >= len(prefix)+len(suffix) &&
+			strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix)
+	}
+	return false
+}
+
+func (c CORSConfig) originAllowed(origin string) bool {
+	for _, pattern := range c.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return c.AllowOrigin != nil && c.AllowOrigin(origin)
+}
+
+func (c CORSConfig) allowsAnyOrigin() bool {
+	for _, pattern := range c.AllowedOrigins {
+		if pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) methodAllowed(method string) bool {
+	for _, m := range c.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSConfig) headersAllowed(headers []string) bool {
+	for _, h := range headers {
+		allowed := false
+		for _, a := range c.AllowedHeaders {
+			if a == "*" || strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func parseHeaderList(s string) []string {
+	var headers []string
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
+// variesByOrigin reports whether the responses depend on the Origin header,
+// which is always the case unless all the origins are allowed without
+// credentials.
+func (c CORSConfig) variesByOrigin() bool {
+	return !c.allowsAnyOrigin() || c.AllowCredentials
+}
+
+// credentialsAllowed reports whether the origin may send credentials, never
+// when it is only allowed by "*" as any site could read the responses then.
+func (c CORSConfig) credentialsAllowed(origin string) bool {
+	if !c.AllowCredentials {
+		return false
+	}
+	for _, pattern := range c.AllowedOrigins {
+		if pattern != "*" && matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return c.AllowOrigin != nil && c.AllowOrigin(origin)
+}
+
+func (c CORSConfig) setOrigin(h http.Header, origin string) {
+	switch {
+	case c.credentialsAllowed(origin):
+		h.Set("Access-Control-Allow-Origin", origin)
+		h.Set("Access-Control-Allow-Credentials", "true")
+	case c.allowsAnyOrigin():
+		h.Set("Access-Control-Allow-Origin", "*")
+	default:
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+}
+
+// NewCORSFilter adds the cross-origin resource sharing headers to the
+// responses and answers the preflight requests itself. For preflight requests
+// to reach the filter an OPTIONS route must be registered on the Endpoint.
+func NewCORSFilter(config CORSConfig) saola.Filter {
+	if len(config.AllowedMethods) == 0 {
+		config.AllowedMethods = []string{"GET", "HEAD", "POST"}
+	}
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetServerRequest(ctx)
+		origin := req.Request.Header.Get("Origin")
+		requestMethod := req.Request.Header.Get("Access-Control-Request-Method")
+		preflight := req.Request.Method == "OPTIONS" && requestMethod != ""
+
+		h := req.Writer.Header()
+		if config.variesByOrigin() {
+			h.Add("Vary", "Origin")
+		}
+		if origin == "" {
+			return s.Do(ctx)
+		}
+		if !preflight {
+			if config.originAllowed(origin) {
+				config.setOrigin(h, origin)
+				if len(config.ExposedHeaders) != 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+				}
+			}
+			return s.Do(ctx)
+		}
+
+		requestHeaders := parseHeaderList(req.Request.Header.Get("Access-Control-Request-Headers"))
+		if !config.originAllowed(origin) || !config.methodAllowed(requestMethod) || !config.headersAllowed(requestHeaders) {
+			req.Writer.WriteHeader(http.StatusForbidden)
+			return nil
+		}
+		config.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+		if len(requestHeaders) != 0 {
+			h.Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+		}
+		if config.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge/time.Second)))
+		}
+		req.Writer.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+}
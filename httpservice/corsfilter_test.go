@@ -0,0 +1,129 @@
+package httpservice_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCORSEndpoint(config httpservice.CORSConfig) *httpservice.Endpoint {
+	cors := httpservice.NewCORSFilter(config)
+	endpoint := httpservice.NewEndpoint()
+	endpoint.GET("/foo", saola.Apply(httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("foo"))
+		return nil
+	}), cors))
+	endpoint.OPTIONS("/foo", saola.Apply(saola.NoopService{}, cors))
+	return endpoint
+}
+
+func corsRequest(e *httpservice.Endpoint, method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "http://example.com/foo", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	e.DoHTTP(context.Background(), w, req)
+	return w
+}
+
+func TestCORSFilterSimpleRequest(t *testing.T) {
+	e := newCORSEndpoint(httpservice.CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		ExposedHeaders: []string{"X-Request-ID"},
+	})
+	w := corsRequest(e, "GET", "https://example.com", nil)
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	w = corsRequest(e, "GET", "https://evil.com", nil)
+	assert.Equal(t, "foo", w.Body.String())
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+
+	w = corsRequest(e, "GET", "", nil)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"), "cached responses without CORS headers must not be reused for other origins")
+}
+
+func TestCORSFilterWildcard(t *testing.T) {
+	e := newCORSEndpoint(httpservice.CORSConfig{AllowedOrigins: []string{"*"}})
+	w := corsRequest(e, "GET", "https://example.com", nil)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Vary"))
+
+	e = newCORSEndpoint(httpservice.CORSConfig{AllowedOrigins: []string{"https://example.com", "*"}, AllowCredentials: true})
+	w = corsRequest(e, "GET", "https://example.com", nil)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	w = corsRequest(e, "GET", "https://evil.com", nil)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"), "credentials must not be allowed for any origin")
+	assert.Equal(t, "Origin", w.Header().Get("Vary"))
+	w = corsRequest(e, "OPTIONS", "https://evil.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Credentials"))
+
+	e = newCORSEndpoint(httpservice.CORSConfig{AllowedOrigins: []string{"https://*.example.com"}})
+	w = corsRequest(e, "GET", "https://api.example.com", nil)
+	assert.Equal(t, "https://api.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	w = corsRequest(e, "GET", "https://example.com", nil)
+	assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSFilterPredicate(t *testing.T) {
+	e := newCORSEndpoint(httpservice.CORSConfig{AllowOrigin: func(origin string) bool {
+		return strings.HasSuffix(origin, ".local")
+	}})
+	w := corsRequest(e, "GET", "http://app.local", nil)
+	assert.Equal(t, "http://app.local", w.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSFilterPreflight(t *testing.T) {
+	e := newCORSEndpoint(httpservice.CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"Content-Type", "X-Request-ID"},
+		MaxAge:         10 * time.Minute,
+	})
+	w := corsRequest(e, "OPTIONS", "https://example.com", map[string]string{
+		"Access-Control-Request-Method":  "PUT",
+		"Access-Control-Request-Headers": "content-type, x-request-id",
+	})
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "content-type, x-request-id", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", w.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSFilterPreflightRejected(t *testing.T) {
+	e := newCORSEndpoint(httpservice.CORSConfig{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"Content-Type"},
+	})
+	for _, headers := range []map[string]string{
+		{"Access-Control-Request-Method": "DELETE"},
+		{"Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Secret"},
+	} {
+		w := corsRequest(e, "OPTIONS", "https://example.com", headers)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	w := corsRequest(e, "OPTIONS", "https://evil.com", map[string]string{"Access-Control-Request-Method": "GET"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
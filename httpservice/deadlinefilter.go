@@ -0,0 +1,126 @@
+package httpservice
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/arjantop/saola"
+)
+
+const (
+	// DeadlineHeader carries the time remaining until the deadline of the
+	// request in the grpc-timeout format (e.g. "250m" for 250 milliseconds).
+	DeadlineHeader    = "X-Request-Timeout"
+	GrpcTimeoutHeader = "Grpc-Timeout"
+)
+
+var errInvalidTimeout = errors.New("invalid timeout")
+
+var timeoutUnits = []struct {
+	unit byte
+	d    time.Duration
+}{
+	{'n', time.Nanosecond},
+	{'u', time.Microsecond},
+	{'m', time.Millisecond},
+	{'S', time.Second},
+	{'M', time.Minute},
+	{'H', time.Hour},
+}
+
+// Timeouts are at most 8 digits long in the grpc-timeout format.
+const maxTimeoutValue = 99999999
+
+func FormatTimeout(d time.Duration) string {
+	if d <= 0 {
+		return "0n"
+	}
+	for _, u := range timeoutUnits {
+		v := d / u.d
+		if v <= maxTimeoutValue {
+			// Round up so that the timeout is never shortened.
+			if d%u.d != 0 {
+				v++
+			}
+			return strconv.FormatInt(int64(v), 10) + string(u.unit)
+		}
+	}
+	return strconv.Itoa(maxTimeoutValue) + "H"
+}
+
+func ParseTimeout(s string) (time.Duration, error) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, errInvalidTimeout
+	}
+	v, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if err != nil || v < 0 {
+		return 0, errInvalidTimeout
+	}
+	for _, u := range timeoutUnits {
+		if u.unit == s[len(s)-1] {
+			if v > math.MaxInt64/int64(u.d) {
+				// Longer than the maximum duration, e.g. 99999999H.
+				return math.MaxInt64, nil
+			}
+			return time.Duration(v) * u.d, nil
+		}
+	}
+	return 0, errInvalidTimeout
+}
+
+func requestTimeout(r *http.Request) (time.Duration, bool) {
+	for _, h := range []string{DeadlineHeader, GrpcTimeoutHeader} {
+		if v := r.Header.Get(h); v != "" {
+			if d, err := ParseTimeout(v); err == nil {
+				return d, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// NewDeadlineFilter applies the deadline propagated by the caller to the
+// request context. Requests that arrive with no time left are rejected with
+// 504 Gateway Timeout.
+func NewDeadlineFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetServerRequest(ctx)
+		d, ok := requestTimeout(req.Request)
+		if !ok {
+			return s.Do(ctx)
+		}
+		if d <= 0 {
+			req.Writer.WriteHeader(http.StatusGatewayTimeout)
+			return context.DeadlineExceeded
+		}
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return s.Do(ctx)
+	})
+}
+
+// NewClientDeadlineFilter propagates the remaining time of the context
+// deadline to the server. Requests whose deadline has already passed are
+// failed without being sent.
+func NewClientDeadlineFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return s.Do(ctx)
+		}
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return context.DeadlineExceeded
+		}
+		cr := GetClientRequest(ctx)
+		if cr.Request.Header == nil {
+			cr.Request.Header = make(http.Header)
+		}
+		cr.Request.Header.Set(DeadlineHeader, FormatTimeout(remaining))
+		return s.Do(ctx)
+	})
+}
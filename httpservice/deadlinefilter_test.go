@@ -0,0 +1,140 @@
+package httpservice_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatTimeout(t *testing.T) {
+	assert.Equal(t, "250000u", httpservice.FormatTimeout(250*time.Millisecond))
+	assert.Equal(t, "99999999n", httpservice.FormatTimeout(99999999*time.Nanosecond))
+	assert.Equal(t, "100000u", httpservice.FormatTimeout(100*time.Millisecond))
+	assert.Equal(t, "100001u", httpservice.FormatTimeout(100000001*time.Nanosecond))
+	assert.Equal(t, "0n", httpservice.FormatTimeout(-time.Second))
+}
+
+func TestParseTimeout(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"250m": 250 * time.Millisecond,
+		"10S":  10 * time.Second,
+		"2M":   2 * time.Minute,
+		"1H":   time.Hour,
+		"5u":   5 * time.Microsecond,
+		"7n":   7 * time.Nanosecond,
+
+		"99999999H": math.MaxInt64,
+	} {
+		d, err := httpservice.ParseTimeout(s)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, d)
+	}
+	for _, s := range []string{"", "m", "10", "10x", "-1S", "123456789S"} {
+		_, err := httpservice.ParseTimeout(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestDeadlineFilter(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.DeadlineHeader, "100m")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	var remaining time.Duration
+	err := httpservice.NewDeadlineFilter().Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		remaining = deadline.Sub(time.Now())
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.True(t, remaining > 0 && remaining <= 100*time.Millisecond)
+}
+
+func TestDeadlineFilterGrpcTimeout(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.GrpcTimeoutHeader, "1S")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	err := httpservice.NewDeadlineFilter().Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		_, ok := ctx.Deadline()
+		assert.True(t, ok)
+		return nil
+	}))
+	assert.NoError(t, err)
+}
+
+func TestDeadlineFilterLongTimeout(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.GrpcTimeoutHeader, "99999999H")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	called := false
+	err := httpservice.NewDeadlineFilter().Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		called = true
+		return ctx.Err()
+	}))
+	assert.NoError(t, err)
+	assert.True(t, called)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestDeadlineFilterExpired(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.DeadlineHeader, "0n")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	err := httpservice.NewDeadlineFilter().Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		assert.Fail(t, "expired request should not be served")
+		return nil
+	}))
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestClientDeadlineFilter(t *testing.T) {
+	var timeout string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout = r.Header.Get(httpservice.DeadlineHeader)
+	}))
+	defer ts.Close()
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewClientDeadlineFilter(),
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	res, err := c.Do(ctx, req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	d, err := httpservice.ParseTimeout(timeout)
+	assert.NoError(t, err)
+	assert.True(t, d > 0 && d <= time.Second)
+}
+
+func TestClientDeadlineFilterExpired(t *testing.T) {
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewClientDeadlineFilter(),
+	}
+
+	req, _ := http.NewRequest("GET", "http://localhost:12345", nil)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	res, err := c.Do(ctx, req)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, res)
+}
@@ -0,0 +1,91 @@
+package httpservice
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/stats"
+)
+
+type clientAttempt struct {
+	original *ClientRequest
+	forked   *ClientRequest
+	detach   func() bool
+	cancel   context.CancelFunc
+}
+
+// Commit detaches the request from the context of the attempt, which is
+// cancelled after the commit, so that the body of the response can still be
+// read until the deadline. Closing the body releases the context of the
+// request.
+func (a clientAttempt) Commit() {
+	a.detach()
+	if res := a.forked.Response; res != nil {
+		res.Body = &cancelBody{res.Body, a.cancel}
+	} else {
+		a.cancel()
+	}
+	a.original.Response = a.forked.Response
+}
+
+func (a clientAttempt) Discard() {
+	if a.forked.Response != nil {
+		a.forked.Response.Body.Close()
+	}
+}
+
+// cloneRequest copies the request with its headers so they can be modified.
+func cloneRequest(r *http.Request) *http.Request {
+	req := new(http.Request)
+	*req = *r
+	req.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		req.Header[k] = v
+	}
+	return req
+}
+
+func forkClientRequest(ctx context.Context, n int) (context.Context, saola.Attempt) {
+	cr := GetClientRequest(ctx)
+	if cr.Request.Method != "GET" && cr.Request.Method != "HEAD" {
+		return ctx, nil
+	}
+	if cr.Request.Body != nil && cr.Request.Body != http.NoBody {
+		return ctx, nil
+	}
+	forked := &ClientRequest{Request: cloneRequest(cr.Request)}
+	rctx, detach, cancel := detachableContext(ctx)
+	return withClientRequest(rctx, forked), clientAttempt{cr, forked, detach, cancel}
+}
+
+// detachableContext returns a context with the values and the deadline of
+// ctx that is cancelled with ctx until it is detached.
+func detachableContext(ctx context.Context) (context.Context, func() bool, context.CancelFunc) {
+	var dctx context.Context
+	var cancel context.CancelFunc
+	if deadline, ok := ctx.Deadline(); ok {
+		dctx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	} else {
+		dctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	}
+	return dctx, context.AfterFunc(ctx, cancel), cancel
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// NewHedgingFilter sends a backup request for slow GET and HEAD requests made
+// through a Client.
+func NewHedgingFilter(policy saola.HedgingPolicy, stats stats.StatsReceiver) saola.Filter {
+	return saola.NewHedgingFilter(policy, forkClientRequest, stats)
+}
@@ -0,0 +1,62 @@
+package httpservice_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/stats/statstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgingFilterClient(t *testing.T) {
+	var requests int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("slow"))
+		} else {
+			w.Write([]byte("fast"))
+		}
+	}))
+	defer ts.Close()
+
+	r := statstest.NewRecorder()
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewHedgingFilter(saola.HedgingPolicy{Delay: 5 * time.Millisecond, Budget: 1}, r),
+	}
+	req, err := http.NewRequest("GET", ts.URL, nil)
+	assert.NoError(t, err)
+	res, err := c.Do(context.Background(), req)
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", string(content))
+	assert.Equal(t, int64(1), r.CounterValue("func.hedge.won"))
+}
+
+func TestHedgingFilterClientPOST(t *testing.T) {
+	ts := NewServer()
+	defer ts.Close()
+
+	r := statstest.NewRecorder()
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Nanosecond, Budget: 1}, r),
+	}
+	req, err := http.NewRequest("POST", ts.URL+"/foo", nil)
+	assert.NoError(t, err)
+	res, err := c.Do(context.Background(), req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, int64(0), r.CounterValue("func.hedge.sent"), "POST requests are never hedged")
+}
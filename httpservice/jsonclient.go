@@ -0,0 +1,153 @@
+package httpservice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Error bodies larger than this are truncated in the returned HttpError.
+const maxErrorBodySize = 64 << 10
+
+// encodeTagged collects the struct fields tagged with `param:"name"` and
+// `query:"name"`, the counterpart of decodeTagged.
+func encodeTagged(v reflect.Value) (map[string]string, url.Values) {
+	params := make(map[string]string)
+	query := make(url.Values)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return params, query
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return params, query
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name := field.Tag.Get("param"); name != "" {
+			params[name] = fmt.Sprint(v.Field(i).Interface())
+		} else if name := field.Tag.Get("query"); name != "" {
+			f := v.Field(i)
+			if f.Kind() == reflect.Slice {
+				for j := 0; j < f.Len(); j++ {
+					query.Add(name, fmt.Sprint(f.Index(j).Interface()))
+				}
+			} else if !f.IsZero() {
+				query.Set(name, fmt.Sprint(f.Interface()))
+			}
+		}
+	}
+	return params, query
+}
+
+// expandPath replaces the ":name" segments of the route with the parameters.
+func expandPath(route string, params map[string]string) (string, error) {
+	segments := strings.Split(route, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			p, ok := params[s[1:]]
+			if !ok {
+				return "", fmt.Errorf("missing parameter %s", s[1:])
+			}
+			segments[i] = url.PathEscape(p)
+		}
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+func hasBody(method string) bool {
+	return method != "GET" && method != "HEAD" && method != "DELETE"
+}
+
+// NewJSONRequest builds a request to the route template (e.g.
+// "http://host/users/:id") from a typed value. Fields tagged with `param` and
+// `query` are put into the URL, the value is sent as a JSON body for methods
+// other than GET, HEAD and DELETE.
+func NewJSONRequest(method, route string, req interface{}) (*http.Request, error) {
+	params, query := encodeTagged(reflect.ValueOf(req))
+	u, err := expandPath(route, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) != 0 {
+		if strings.Contains(u, "?") {
+			u += "&" + query.Encode()
+		} else {
+			u += "?" + query.Encode()
+		}
+	}
+	var body io.Reader
+	if hasBody(method) && req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	r, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	r.Header.Set("Accept", "application/json")
+	return r, nil
+}
+
+func responseError(res *http.Response) *HttpError {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBodySize))
+	var body jsonError
+	if json.Unmarshal(b, &body) == nil && body.Message != "" {
+		return NewHttpError(res.StatusCode, body.Message)
+	}
+	message := strings.TrimSpace(string(b))
+	if message == "" {
+		message = http.StatusText(res.StatusCode)
+	}
+	return NewHttpError(res.StatusCode, message)
+}
+
+// CallJSON sends the typed request through the client and decodes the JSON
+// response. Responses with a non-2xx status code or classified as failures by
+// the client are returned as an *HttpError, wrapping the *ResponseError of the
+// classified ones.
+func CallJSON[Req, Resp any](ctx context.Context, c *Client, method, route string, req Req) (Resp, error) {
+	var resp Resp
+	r, err := NewJSONRequest(method, route, req)
+	if err != nil {
+		return resp, err
+	}
+	res, err := c.Do(ctx, r)
+	if res != nil {
+		defer res.Body.Close()
+	}
+	var resErr *ResponseError
+	if errors.As(err, &resErr) {
+		httpErr := responseError(resErr.Response)
+		httpErr.cause = resErr
+		return resp, httpErr
+	} else if err != nil {
+		return resp, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return resp, responseError(res)
+	}
+	if res.StatusCode == http.StatusNoContent || method == "HEAD" {
+		return resp, nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil && err != io.EOF {
+		return resp, err
+	}
+	return resp, nil
+}
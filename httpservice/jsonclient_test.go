@@ -0,0 +1,119 @@
+package httpservice_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func newGreetServer() *httptest.Server {
+	endpoint := greetEndpoint()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		endpoint.DoHTTP(context.Background(), w, r)
+	}))
+}
+
+type greetCall struct {
+	Name     string   `param:"name" json:"-"`
+	Greeting string   `json:"greeting"`
+	Times    int      `query:"times" json:"-"`
+	Tags     []string `query:"tag" json:"-"`
+}
+
+func TestNewJSONRequest(t *testing.T) {
+	req, err := httpservice.NewJSONRequest("POST", "http://example.com/greet/:name", greetCall{
+		Name:     "bob smith",
+		Greeting: "hi",
+		Times:    2,
+		Tags:     []string{"a", "b"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/greet/bob%20smith?tag=a&tag=b&times=2", req.URL.String())
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, `{"greeting":"hi"}`, string(body))
+
+	req, err = httpservice.NewJSONRequest("GET", "http://example.com/greet/:name", greetCall{Name: "bob"})
+	assert.NoError(t, err)
+	assert.Nil(t, req.Body)
+
+	_, err = httpservice.NewJSONRequest("GET", "http://example.com/greet/:name", struct{}{})
+	assert.Error(t, err, "missing parameter")
+}
+
+func TestCallJSON(t *testing.T) {
+	ts := newGreetServer()
+	defer ts.Close()
+	c := &httpservice.Client{Transport: &http.Transport{}}
+
+	resp, err := httpservice.CallJSON[greetCall, greetResponse](context.Background(), c, "POST", ts.URL+"/greet/:name", greetCall{
+		Name:     "bob",
+		Greeting: "hi",
+		Times:    1,
+		Tags:     []string{"a"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, greetResponse{Message: "hi bob!", Tags: []string{"a"}}, resp)
+}
+
+func TestCallJSONError(t *testing.T) {
+	ts := newGreetServer()
+	defer ts.Close()
+	c := &httpservice.Client{Transport: &http.Transport{}}
+
+	_, err := httpservice.CallJSON[greetCall, greetResponse](context.Background(), c, "POST", ts.URL+"/greet/:name", greetCall{Name: "nobody"})
+	assert.Equal(t, httpservice.NewHttpError(http.StatusNotFound, "unknown person"), err)
+
+	_, err = httpservice.CallJSON[greetCall, greetResponse](context.Background(), c, "GET", ts.URL+"/missing/:name", greetCall{Name: "bob"})
+	httpErr, ok := err.(*httpservice.HttpError)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+}
+
+type closeTrackingTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+type closeTrackingBody struct {
+	io.ReadCloser
+	t *closeTrackingTransport
+}
+
+func (b closeTrackingBody) Close() error {
+	b.t.closed++
+	return b.ReadCloser.Close()
+}
+
+func (t *closeTrackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.RoundTripper.RoundTrip(req)
+	if err == nil {
+		res.Body = closeTrackingBody{res.Body, t}
+	}
+	return res, err
+}
+
+func TestCallJSONClassifier(t *testing.T) {
+	ts := newGreetServer()
+	defer ts.Close()
+	tr := &closeTrackingTransport{RoundTripper: &http.Transport{}}
+	c := &httpservice.Client{Transport: tr, Classifier: httpservice.StatusClassifier}
+
+	_, err := httpservice.CallJSON[greetCall, greetResponse](context.Background(), c, "POST", ts.URL+"/greet/:name", greetCall{Name: "nobody"})
+	httpErr, ok := err.(*httpservice.HttpError)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+		assert.Equal(t, "unknown person", httpErr.Message)
+	}
+	var resErr *httpservice.ResponseError
+	assert.True(t, errors.As(err, &resErr), "classified response is wrapped")
+	assert.False(t, httpservice.IsRetryable(err), "4xx is not retryable")
+	assert.Equal(t, 1, tr.closed, "body of the failed response is closed")
+}
@@ -0,0 +1,246 @@
+package httpservice
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// HttpError is an error with the status code of the response.
+type HttpError struct {
+	StatusCode int
+	Message    string
+	// cause is the *ResponseError of a response classified by the client.
+	cause error
+}
+
+func NewHttpError(code int, message string) *HttpError {
+	return &HttpError{StatusCode: code, Message: message}
+}
+
+func (e *HttpError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+func (e *HttpError) Unwrap() error {
+	return e.cause
+}
+
+// Validator is implemented by requests that validate themselves after they
+// are decoded.
+type Validator interface {
+	Validate() error
+}
+
+// StatusCoder is implemented by responses that are not sent with 200 OK.
+type StatusCoder interface {
+	StatusCode() int
+}
+
+type encoder struct {
+	mediaType string
+	encode    func(w io.Writer, v interface{}) error
+}
+
+var encoders = []encoder{
+	{"application/json", func(w io.Writer, v interface{}) error {
+		return json.NewEncoder(w).Encode(v)
+	}},
+	{"application/xml", func(w io.Writer, v interface{}) error {
+		return xml.NewEncoder(w).Encode(v)
+	}},
+}
+
+// negotiateEncoder returns the encoder for the media type with the highest
+// quality in the Accept header, JSON being preferred.
+func negotiateEncoder(accept string) (encoder, bool) {
+	if accept == "" {
+		return encoders[0], true
+	}
+	var selected encoder
+	var selectedQ float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, q := parseCoding(part)
+		if q <= selectedQ {
+			continue
+		}
+		for _, e := range encoders {
+			if mediaType == e.mediaType || mediaType == "*/*" || mediaType == "application/*" {
+				selected, selectedQ = e, q
+				break
+			}
+		}
+	}
+	return selected, selectedQ > 0
+}
+
+type jsonError struct {
+	XMLName xml.Name `json:"-" xml:"error"`
+	Message string   `json:"error" xml:"message"`
+}
+
+func writeError(w http.ResponseWriter, e encoder, err error) {
+	var httpErr *HttpError
+	if !errors.As(err, &httpErr) {
+		httpErr = NewHttpError(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+	w.Header().Set("Content-Type", e.mediaType+"; charset=utf-8")
+	w.WriteHeader(httpErr.StatusCode)
+	e.encode(w, jsonError{Message: httpErr.Message})
+}
+
+func setField(f reflect.Value, values []string) error {
+	if f.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(f.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setField(slice.Index(i), []string{v}); err != nil {
+				return err
+			}
+		}
+		f.Set(slice)
+		return nil
+	}
+	v := values[0]
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(v)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(v, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(v, 10, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(v, f.Type().Bits())
+		if err != nil {
+			return err
+		}
+		f.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported field type %s", f.Type())
+	}
+	return nil
+}
+
+// decodeTagged sets the struct fields tagged with `param:"name"` from the
+// route parameters and with `query:"name"` from the query string.
+func decodeTagged(v reflect.Value, params Params, r *http.Request) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	query := r.URL.Query()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		var values []string
+		var name string
+		if name = field.Tag.Get("param"); name != "" {
+			if p := params.Get(name); p != "" {
+				values = []string{p}
+			}
+		} else if name = field.Tag.Get("query"); name != "" {
+			values = query[name]
+		}
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(v.Field(i), values); err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+	return nil
+}
+
+func decodeRequest(ctx context.Context, r *http.Request, req interface{}) error {
+	if r.Body != nil && r.ContentLength != 0 {
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			if mediaType, _, _ := mime.ParseMediaType(ct); mediaType != "application/json" {
+				return NewHttpError(http.StatusUnsupportedMediaType, "unsupported content type: "+ct)
+			}
+		}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil && err != io.EOF {
+			return NewHttpError(http.StatusBadRequest, "invalid request body: "+err.Error())
+		}
+	}
+	if err := decodeTagged(reflect.ValueOf(req).Elem(), GetParams(ctx), r); err != nil {
+		return NewHttpError(http.StatusBadRequest, err.Error())
+	}
+	if v, ok := req.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return NewHttpError(http.StatusBadRequest, err.Error())
+		}
+	}
+	return nil
+}
+
+// JSONService adapts a typed function to an HttpService. The request is
+// decoded from the JSON body, route parameters and query string and the
+// response is encoded with the negotiated content type. Errors are sent with
+// the status code of an HttpError or 500 Internal Server Error.
+type JSONService[Req, Resp any] func(ctx context.Context, req Req) (Resp, error)
+
+func NewJSONService[Req, Resp any](f func(ctx context.Context, req Req) (Resp, error)) JSONService[Req, Resp] {
+	return JSONService[Req, Resp](f)
+}
+
+func (f JSONService[Req, Resp]) DoHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	e, ok := negotiateEncoder(r.Header.Get("Accept"))
+	if !ok {
+		err := NewHttpError(http.StatusNotAcceptable, "no acceptable content type")
+		writeError(w, encoders[0], err)
+		return err
+	}
+
+	var req Req
+	if err := decodeRequest(ctx, r, &req); err != nil {
+		writeError(w, e, err)
+		return err
+	}
+	resp, err := f(ctx, req)
+	if err != nil {
+		writeError(w, e, err)
+		return err
+	}
+
+	code := http.StatusOK
+	if sc, ok := interface{}(resp).(StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	w.Header().Set("Content-Type", e.mediaType+"; charset=utf-8")
+	w.WriteHeader(code)
+	return e.encode(w, resp)
+}
+
+func (f JSONService[Req, Resp]) Do(ctx context.Context) error {
+	return Do(f, ctx)
+}
+
+func (f JSONService[Req, Resp]) Name() string {
+	return "httpjson"
+}
@@ -0,0 +1,123 @@
+package httpservice_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+type greetRequest struct {
+	Name     string   `param:"name"`
+	Greeting string   `json:"greeting"`
+	Times    int      `query:"times"`
+	Tags     []string `query:"tag"`
+}
+
+func (r greetRequest) Validate() error {
+	if r.Times < 0 {
+		return errors.New("times must not be negative")
+	}
+	return nil
+}
+
+type greetResponse struct {
+	Message string   `json:"message" xml:"message"`
+	Tags    []string `json:"tags,omitempty" xml:"tag"`
+}
+
+type createdResponse struct{}
+
+func (r createdResponse) StatusCode() int {
+	return http.StatusCreated
+}
+
+func greetEndpoint() *httpservice.Endpoint {
+	endpoint := httpservice.NewEndpoint()
+	endpoint.POST("/greet/:name", httpservice.NewJSONService(func(ctx context.Context, req greetRequest) (greetResponse, error) {
+		if req.Name == "nobody" {
+			return greetResponse{}, httpservice.NewHttpError(http.StatusNotFound, "unknown person")
+		}
+		if req.Name == "error" {
+			return greetResponse{}, errors.New("internal details")
+		}
+		return greetResponse{
+			Message: strings.Repeat(req.Greeting+" "+req.Name+"!", req.Times),
+			Tags:    req.Tags,
+		}, nil
+	}))
+	endpoint.PUT("/created", httpservice.NewJSONService(func(ctx context.Context, req struct{}) (createdResponse, error) {
+		return createdResponse{}, nil
+	}))
+	return endpoint
+}
+
+func doJSON(method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	greetEndpoint().DoHTTP(context.Background(), w, req)
+	return w
+}
+
+func TestJSONService(t *testing.T) {
+	w := doJSON("POST", "http://example.com/greet/bob?times=2&tag=a&tag=b", `{"greeting":"hi"}`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"message":"hi bob!hi bob!","tags":["a","b"]}`, w.Body.String())
+}
+
+func TestJSONServiceXML(t *testing.T) {
+	w := doJSON("POST", "http://example.com/greet/bob?times=1", `{"greeting":"hi"}`, map[string]string{
+		"Accept": "application/json;q=0.5, application/xml",
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "<greetResponse><message>hi bob!</message></greetResponse>", w.Body.String())
+}
+
+func TestJSONServiceNotAcceptable(t *testing.T) {
+	w := doJSON("POST", "http://example.com/greet/bob", `{}`, map[string]string{"Accept": "text/html"})
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+}
+
+func TestJSONServiceBadRequest(t *testing.T) {
+	for _, url := range []string{
+		"http://example.com/greet/bob?times=x",
+		"http://example.com/greet/bob?times=-1",
+	} {
+		w := doJSON("POST", url, `{}`, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+
+	w := doJSON("POST", "http://example.com/greet/bob", `{"greeting":`, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = doJSON("POST", "http://example.com/greet/bob", `greeting=hi`, map[string]string{
+		"Content-Type": "application/x-www-form-urlencoded",
+	})
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestJSONServiceErrors(t *testing.T) {
+	w := doJSON("POST", "http://example.com/greet/nobody", ``, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error":"unknown person"}`, w.Body.String())
+
+	w = doJSON("POST", "http://example.com/greet/error", ``, nil)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"error":"Internal Server Error"}`, w.Body.String(), "internal errors should not be exposed")
+}
+
+func TestJSONServiceStatusCode(t *testing.T) {
+	w := doJSON("PUT", "http://example.com/created", ``, nil)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{}`, w.Body.String())
+}
@@ -0,0 +1,44 @@
+package rediscache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/redisservice"
+	"github.com/garyburd/redigo/redis"
+)
+
+type store struct {
+	commands redisservice.Commands
+	prefix   string
+}
+
+// NewStore stores the responses of the cache filter encoded as JSON in redis
+// under the keys with the prefix.
+func NewStore(c redisservice.Client, prefix string) httpservice.CacheStore {
+	return &store{redisservice.NewCommands(c), prefix}
+}
+
+func (s *store) Get(ctx context.Context, key string) (*httpservice.CachedResponse, error) {
+	v, err := s.commands.Get(ctx, s.prefix+key)
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	r := new(httpservice.CachedResponse)
+	if err := json.Unmarshal([]byte(v), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (s *store) Set(ctx context.Context, key string, r *httpservice.CachedResponse, ttl time.Duration) error {
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.commands.Set(ctx, s.prefix+key, v, ttl)
+}
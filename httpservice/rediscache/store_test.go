@@ -0,0 +1,51 @@
+package rediscache_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/httpservice"
+	"github.com/arjantop/saola/httpservice/rediscache"
+	"github.com/arjantop/saola/redisservice"
+	"github.com/stretchr/testify/assert"
+)
+
+// mapClient serves GET and SET from a map.
+type mapClient struct {
+	redisservice.Client
+	values map[string]interface{}
+	args   [][]interface{}
+}
+
+func (c *mapClient) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	c.args = append(c.args, args)
+	if cmd == "SET" {
+		c.values[args[0].(string)] = args[1]
+		return "OK", nil
+	}
+	return c.values[args[0].(string)], nil
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	c := &mapClient{values: make(map[string]interface{})}
+	s := rediscache.NewStore(c, "cache:")
+
+	r, err := s.Get(ctx, "http://example.com/")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	stored := &httpservice.CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Etag": {`"v1"`}},
+		Body:       []byte("a"),
+		Date:       time.Now().Round(time.Second).UTC(),
+	}
+	assert.NoError(t, s.Set(ctx, "http://example.com/", stored, time.Minute))
+	assert.Equal(t, []interface{}{"cache:http://example.com/", c.values["cache:http://example.com/"], "PX", int64(60000)}, c.args[1])
+	r, err = s.Get(ctx, "http://example.com/")
+	assert.NoError(t, err)
+	assert.Equal(t, stored, r)
+}
@@ -0,0 +1,63 @@
+package httpservice
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/arjantop/saola"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// Longer ids sent by clients are replaced to keep logs and headers bounded.
+const maxRequestIDLength = 128
+
+const requestIDKey key = 2
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+func GetRequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewRequestIDFilter puts the request id sent by the caller, or a newly
+// generated one, into the context and echoes it in the response.
+func NewRequestIDFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetServerRequest(ctx)
+		id := req.Request.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+		req.Writer.Header().Set(RequestIDHeader, id)
+		return s.Do(WithRequestID(ctx, id))
+	})
+}
+
+// NewClientRequestIDFilter forwards the request id in the context to the
+// server.
+func NewClientRequestIDFilter() saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		if id := GetRequestID(ctx); id != "" {
+			cr := GetClientRequest(ctx)
+			if cr.Request.Header == nil {
+				cr.Request.Header = make(http.Header)
+			}
+			cr.Request.Header.Set(RequestIDHeader, id)
+		}
+		return s.Do(ctx)
+	})
+}
@@ -0,0 +1,77 @@
+package httpservice_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/httpservice"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDFilterGenerate(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	var id string
+	err := httpservice.NewRequestIDFilter().Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		id = httpservice.GetRequestID(ctx)
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Len(t, id, 32)
+	assert.Equal(t, id, w.Header().Get(httpservice.RequestIDHeader))
+}
+
+func TestRequestIDFilterExisting(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.RequestIDHeader, "abc")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	var id string
+	err := httpservice.NewRequestIDFilter().Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		id = httpservice.GetRequestID(ctx)
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", id)
+	assert.Equal(t, "abc", w.Header().Get(httpservice.RequestIDHeader))
+}
+
+func TestRequestIDFilterLogEntry(t *testing.T) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
+	req.Header.Set(httpservice.RequestIDHeader, "abc")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	var logEntry httpservice.LogEntry
+	s := saola.Apply(saola.NoopService{},
+		httpservice.NewRequestLogFilter(func(e httpservice.LogEntry) {
+			logEntry = e
+		}),
+		httpservice.NewRequestIDFilter())
+	assert.NoError(t, s.Do(ctx))
+	assert.Equal(t, "abc", logEntry.RequestID)
+}
+
+func TestClientRequestIDFilter(t *testing.T) {
+	var id string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = r.Header.Get(httpservice.RequestIDHeader)
+	}))
+	defer ts.Close()
+	c := httpservice.Client{
+		Transport: &http.Transport{},
+		Filter:    httpservice.NewClientRequestIDFilter(),
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	res, err := c.Do(httpservice.WithRequestID(context.Background(), "abc"), req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "abc", id)
+}
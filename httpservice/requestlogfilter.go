@@ -1,20 +1,35 @@
 package httpservice
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/arjantop/saola"
-	"golang.org/x/net/context"
 )
 
 type LogEntry struct {
 	RemoteAddr    string
+	RequestID     string
 	RequestTime   time.Time
 	RequestMethod string
 	RequestPath   string
+	RequestQuery  string
+	Protocol      string
+	Route         string
+	UserAgent     string
+	Referer       string
 	StatusCode    int
+	BytesWritten  int64
 	Latency       time.Duration
+	Error         error
 }
 
 func NewRequestLogFilter(f func(e LogEntry)) saola.Filter {
@@ -29,14 +44,36 @@ func NewRequestLogFilter(f func(e LogEntry)) saola.Filter {
 		if si, ok := req.Writer.(StatusCodeInterceptor); ok {
 			statusCode = si.StatusCode()
 		}
+		var bytesWritten int64
+		if bi, ok := req.Writer.(BytesWrittenInterceptor); ok {
+			bytesWritten = bi.BytesWritten()
+		}
+
+		requestID := GetRequestID(ctx)
+		if requestID == "" {
+			// The request id filter may be applied after this one.
+			requestID = req.Writer.Header().Get(RequestIDHeader)
+		}
+		route := GetRoute(ctx)
+		if ri, ok := req.Writer.(RouteInterceptor); ok && route == "" {
+			route = ri.Route()
+		}
 
 		entry := LogEntry{
 			RemoteAddr:    req.Request.RemoteAddr,
+			RequestID:     requestID,
 			RequestTime:   start,
 			RequestMethod: req.Request.Method,
 			RequestPath:   req.Request.URL.Path,
+			RequestQuery:  req.Request.URL.RawQuery,
+			Protocol:      req.Request.Proto,
+			Route:         route,
+			UserAgent:     req.Request.UserAgent(),
+			Referer:       req.Request.Referer(),
 			StatusCode:    statusCode,
+			BytesWritten:  bytesWritten,
 			Latency:       latency,
+			Error:         err,
 		}
 		f(entry)
 		return err
@@ -54,3 +91,127 @@ func NewStdRequestLogFilter() saola.Filter {
 			e.Latency)
 	})
 }
+
+// SkipLogEntries does not log the entries matching the predicate, e.g. health
+// checks.
+func SkipLogEntries(skip func(e LogEntry) bool, f func(e LogEntry)) func(e LogEntry) {
+	return func(e LogEntry) {
+		if !skip(e) {
+			f(e)
+		}
+	}
+}
+
+// SampleLogEntries logs only the given fraction of the entries.
+func SampleLogEntries(rate float64, f func(e LogEntry)) func(e LogEntry) {
+	return func(e LogEntry) {
+		if rand.Float64() < rate {
+			f(e)
+		}
+	}
+}
+
+const combinedLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// escapeLogItem escapes the quotes, backslashes and non-printable bytes the
+// way Apache does so that a request can not forge or split the log fields.
+func escapeLogItem(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// CombinedLogFormat writes the entries in the Apache combined log format.
+func CombinedLogFormat(w io.Writer) func(e LogEntry) {
+	var lock sync.Mutex
+	return func(e LogEntry) {
+		host, _, err := net.SplitHostPort(e.RemoteAddr)
+		if err != nil {
+			host = e.RemoteAddr
+		}
+		uri := e.RequestPath
+		if e.RequestQuery != "" {
+			uri += "?" + e.RequestQuery
+		}
+		size := "-"
+		if e.BytesWritten != 0 {
+			size = strconv.FormatInt(e.BytesWritten, 10)
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		fmt.Fprintf(w, "%s - - [%s] \"%s %s %s\" %d %s %q %q\n",
+			orDash(host),
+			e.RequestTime.Format(combinedLogTimeFormat),
+			escapeLogItem(e.RequestMethod),
+			escapeLogItem(uri),
+			escapeLogItem(e.Protocol),
+			e.StatusCode,
+			size,
+			orDash(e.Referer),
+			orDash(e.UserAgent))
+	}
+}
+
+type jsonLogEntry struct {
+	Time         time.Time `json:"time"`
+	RemoteAddr   string    `json:"remote_addr"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Query        string    `json:"query,omitempty"`
+	Protocol     string    `json:"protocol"`
+	Route        string    `json:"route,omitempty"`
+	UserAgent    string    `json:"user_agent,omitempty"`
+	Referer      string    `json:"referer,omitempty"`
+	Status       int       `json:"status"`
+	BytesWritten int64     `json:"bytes_written"`
+	Latency      float64   `json:"latency"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// JSONLogFormat writes the entries as JSON objects, one per line. Latency is
+// in seconds.
+func JSONLogFormat(w io.Writer) func(e LogEntry) {
+	var lock sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(e LogEntry) {
+		entry := jsonLogEntry{
+			Time:         e.RequestTime,
+			RemoteAddr:   e.RemoteAddr,
+			RequestID:    e.RequestID,
+			Method:       e.RequestMethod,
+			Path:         e.RequestPath,
+			Query:        e.RequestQuery,
+			Protocol:     e.Protocol,
+			Route:        e.Route,
+			UserAgent:    e.UserAgent,
+			Referer:      e.Referer,
+			Status:       e.StatusCode,
+			BytesWritten: e.BytesWritten,
+			Latency:      e.Latency.Seconds(),
+		}
+		if e.Error != nil {
+			entry.Error = e.Error.Error()
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		enc.Encode(entry)
+	}
+}
@@ -1,13 +1,18 @@
 package httpservice_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/arjantop/saola"
 	"github.com/arjantop/saola/httpservice"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func TestRequestLogFilter(t *testing.T) {
@@ -36,6 +41,107 @@ func TestRequestLogFilterNoStatusCodeInterceptor(t *testing.T) {
 	assert.Equal(t, 0, logEntry.StatusCode, "No interceptor present")
 }
 
+func TestRequestLogFilterEntryFields(t *testing.T) {
+	w, _ := newTestingResponseWriter()
+	req, _ := http.NewRequest("GET", "http://localhost:8080/foo?a=b", nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set("User-Agent", "agent")
+	req.Header.Set("Referer", "http://example.com")
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+	var logEntry httpservice.LogEntry
+	s := saola.Apply(saola.FuncService(func(ctx context.Context) error {
+		httpservice.GetServerRequest(ctx).Writer.Write([]byte("hello"))
+		return errors.New("error")
+	}), httpservice.NewRequestLogFilter(func(e httpservice.LogEntry) {
+		logEntry = e
+	}))
+	assert.Error(t, s.Do(ctx))
+	assert.Equal(t, "a=b", logEntry.RequestQuery)
+	assert.Equal(t, "HTTP/1.1", logEntry.Protocol)
+	assert.Equal(t, "agent", logEntry.UserAgent)
+	assert.Equal(t, "http://example.com", logEntry.Referer)
+	assert.Equal(t, int64(5), logEntry.BytesWritten)
+	assert.Equal(t, errors.New("error"), logEntry.Error)
+}
+
+func TestRequestLogFilterRoute(t *testing.T) {
+	endpoint := httpservice.NewEndpoint()
+	endpoint.GET("/hello/:name", saola.NoopService{})
+	var logEntry httpservice.LogEntry
+	s := saola.Apply(endpoint, httpservice.NewRequestLogFilter(func(e httpservice.LogEntry) {
+		logEntry = e
+	}))
+
+	req, _ := http.NewRequest("GET", "http://localhost:8080/hello/bob", nil)
+	w := httpservice.NewResponseWriter(httptest.NewRecorder())
+	assert.NoError(t, s.Do(httpservice.WithServerRequest(context.Background(), w, req)))
+	assert.Equal(t, "/hello/:name", logEntry.Route)
+}
+
+var testLogEntry = httpservice.LogEntry{
+	RemoteAddr:    "127.0.0.1:1234",
+	RequestID:     "abc",
+	RequestTime:   time.Date(2015, 10, 9, 13, 55, 36, 0, time.FixedZone("", -7*60*60)),
+	RequestMethod: "GET",
+	RequestPath:   "/foo",
+	RequestQuery:  "a=b",
+	Protocol:      "HTTP/1.0",
+	UserAgent:     "agent",
+	StatusCode:    200,
+	BytesWritten:  2326,
+	Latency:       1500 * time.Millisecond,
+}
+
+func TestCombinedLogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	httpservice.CombinedLogFormat(&buf)(testLogEntry)
+	assert.Equal(t, `127.0.0.1 - - [09/Oct/2015:13:55:36 -0700] "GET /foo?a=b HTTP/1.0" 200 2326 "-" "agent"`+"\n", buf.String())
+}
+
+func TestCombinedLogFormatEscape(t *testing.T) {
+	var buf bytes.Buffer
+	e := testLogEntry
+	e.RequestPath = "/foo\" 200 1 \"-\" \"-\"\n127.0.0.1\\"
+	e.RequestQuery = ""
+	httpservice.CombinedLogFormat(&buf)(e)
+	assert.Equal(t, `127.0.0.1 - - [09/Oct/2015:13:55:36 -0700] "GET /foo\" 200 1 \"-\" \"-\"\x0a127.0.0.1\\ HTTP/1.0" 200 2326 "-" "agent"`+"\n", buf.String())
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	httpservice.JSONLogFormat(&buf)(testLogEntry)
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "abc", decoded["request_id"])
+	assert.Equal(t, "/foo", decoded["path"])
+	assert.Equal(t, 200.0, decoded["status"])
+	assert.Equal(t, 1.5, decoded["latency"])
+	assert.NotContains(t, decoded, "error")
+}
+
+func TestSkipLogEntries(t *testing.T) {
+	var logged int
+	f := httpservice.SkipLogEntries(func(e httpservice.LogEntry) bool {
+		return e.RequestPath == "/health"
+	}, func(e httpservice.LogEntry) {
+		logged++
+	})
+	f(httpservice.LogEntry{RequestPath: "/health"})
+	f(httpservice.LogEntry{RequestPath: "/foo"})
+	assert.Equal(t, 1, logged)
+}
+
+func TestSampleLogEntries(t *testing.T) {
+	var logged int
+	none := httpservice.SampleLogEntries(0, func(e httpservice.LogEntry) { logged++ })
+	all := httpservice.SampleLogEntries(1, func(e httpservice.LogEntry) { logged++ })
+	for i := 0; i < 10; i++ {
+		none(httpservice.LogEntry{})
+		all(httpservice.LogEntry{})
+	}
+	assert.Equal(t, 10, logged)
+}
+
 func BenchmarkRequestLog(b *testing.B) {
 	req, _ := http.NewRequest("POST", "http://localhost:8080/foo", nil)
 	ctx := httpservice.WithServerRequest(context.Background(), NoopResponseWriter{}, req)
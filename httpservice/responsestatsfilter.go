@@ -1,25 +1,72 @@
 package httpservice
 
 import (
+	"context"
+	"io"
 	"strconv"
 	"time"
 
 	"github.com/arjantop/saola"
 	"github.com/arjantop/saola/stats"
-	"golang.org/x/net/context"
 )
 
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.n += int64(n)
+	return n, err
+}
+
+var standardMethods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"CONNECT": true,
+	"OPTIONS": true,
+	"TRACE":   true,
+}
+
+// methodName returns the method used in the stats, all non-standard methods
+// are counted as other to bound the number of stats.
+func methodName(method string) string {
+	if standardMethods[method] {
+		return method
+	}
+	return "other"
+}
+
 func NewResponseStatsFilter(stats stats.StatsReceiver) saola.Filter {
 	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetServerRequest(ctx)
+
+		serviceStats := stats.Scope(s.Name())
+		inflightStat := serviceStats.Gauge("http.inflight")
+
+		var body *countingReadCloser
+		if req.Request.Body != nil {
+			body = &countingReadCloser{ReadCloser: req.Request.Body}
+			req.Request.Body = body
+			defer func() {
+				req.Request.Body = body.ReadCloser
+			}()
+		}
+
+		inflightStat.Add(1)
+		defer inflightStat.Add(-1)
 		start := time.Now()
 		err := s.Do(ctx)
 		latency := time.Now().Sub(start)
 
-		req := GetServerRequest(ctx)
-
-		serviceStats := stats.Scope(s.Name())
 		statusStats := serviceStats.Scope("http.status")
 		statusTimeStats := serviceStats.Scope("http.time")
+		methodStats := serviceStats.Scope("http.method").Scope(methodName(req.Request.Method))
 
 		var statusCode int
 		if si, ok := req.Writer.(StatusCodeInterceptor); ok {
@@ -35,6 +82,18 @@ func NewResponseStatsFilter(stats stats.StatsReceiver) saola.Filter {
 		statusTimeStats.Timer(statusCodeStr).Add(latency)
 		statusTimeStats.Timer(statusCodeClass).Add(latency)
 
+		methodStats.Counter("requests").Incr()
+		methodStats.Timer("time").Add(latency)
+
+		if body != nil {
+			serviceStats.Stat("http.request_size").Add(float64(body.n))
+			methodStats.Stat("request_size").Add(float64(body.n))
+		}
+		if bi, ok := req.Writer.(BytesWrittenInterceptor); ok {
+			serviceStats.Stat("http.response_size").Add(float64(bi.BytesWritten()))
+			methodStats.Stat("response_size").Add(float64(bi.BytesWritten()))
+		}
+
 		return err
 	})
 }
@@ -1,15 +1,17 @@
 package httpservice_test
 
 import (
+	"context"
 	"errors"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/arjantop/saola"
 	"github.com/arjantop/saola/httpservice"
 	"github.com/arjantop/saola/stats/statstest"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func newContext(method string) context.Context {
@@ -55,6 +57,51 @@ func TestResponseStatsFilter(t *testing.T) {
 	assert.True(t, r.TimerValue("func.http.time.4xx") > 0)
 }
 
+func TestResponseStatsFilterSizes(t *testing.T) {
+	r := statstest.NewRecorder()
+	w, _ := newTestingResponseWriter()
+	req, _ := http.NewRequest("POST", "http://localhost:8080/foo", strings.NewReader("request"))
+	ctx := httpservice.WithServerRequest(context.Background(), w, req)
+
+	err := httpservice.NewResponseStatsFilter(r).Do(ctx, saola.FuncService(func(ctx context.Context) error {
+		assert.Equal(t, 1.0, r.GaugeValue("func.http.inflight"))
+		req := httpservice.GetServerRequest(ctx)
+		ioutil.ReadAll(req.Request.Body)
+		req.Writer.Write([]byte("response!"))
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, r.GaugeValue("func.http.inflight"))
+	assert.Equal(t, []float64{7}, r.StatValues("func.http.request_size"))
+	assert.Equal(t, []float64{9}, r.StatValues("func.http.response_size"))
+	assert.Equal(t, []float64{7}, r.StatValues("func.http.method.POST.request_size"))
+	assert.Equal(t, []float64{9}, r.StatValues("func.http.method.POST.response_size"))
+	assert.Equal(t, int64(1), r.CounterValue("func.http.method.POST.requests"))
+	assert.True(t, r.TimerValue("func.http.method.POST.time") > 0)
+}
+
+func TestResponseStatsFilterOtherMethod(t *testing.T) {
+	r := statstest.NewRecorder()
+	f := httpservice.NewResponseStatsFilter(r)
+	err := f.Do(newContext("PROPFIND"), saola.FuncService(func(ctx context.Context) error {
+		return nil
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), r.CounterValue("func.http.method.other.requests"))
+	assert.Equal(t, int64(0), r.CounterValue("func.http.method.PROPFIND.requests"))
+}
+
+func TestResponseStatsFilterInflightOnPanic(t *testing.T) {
+	r := statstest.NewRecorder()
+	f := httpservice.NewResponseStatsFilter(r)
+	assert.Panics(t, func() {
+		f.Do(newContext("GET"), saola.FuncService(func(ctx context.Context) error {
+			panic("panic")
+		}))
+	})
+	assert.Equal(t, 0.0, r.GaugeValue("func.http.inflight"))
+}
+
 func BenchmarkResponseStatsFilter(b *testing.B) {
 	r := statstest.NewRecorder()
 	req, _ := http.NewRequest("GET", "http://localhost:8080/foo", nil)
@@ -1,34 +1,137 @@
 package httpservice
 
-import "net/http"
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
 
 type StatusCodeInterceptor interface {
 	StatusCode() int
 }
 
+type BytesWrittenInterceptor interface {
+	BytesWritten() int64
+}
+
+type RouteInterceptor interface {
+	SetRoute(string)
+	Route() string
+}
+
+var errHijackNotSupported = errors.New("hijacking not supported")
+
 type ResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode      int
+	bytesWritten    int64
+	route           string
+	created         time.Time
+	timeToFirstByte time.Duration
+	header          http.Header
+	hijacked        bool
 }
 
 func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
-	return &ResponseWriter{w, 0}
+	return &ResponseWriter{ResponseWriter: w, created: time.Now()}
 }
 
-func (w *ResponseWriter) WriteHeader(code int) {
+func (w *ResponseWriter) writeStarted(code int) {
 	if w.statusCode == 0 {
 		w.statusCode = code
+		w.timeToFirstByte = time.Now().Sub(w.created)
+		w.header = make(http.Header, len(w.Header()))
+		for k, v := range w.Header() {
+			w.header[k] = append([]string(nil), v...)
+		}
 	}
+}
+
+func (w *ResponseWriter) WriteHeader(code int) {
+	w.writeStarted(code)
 	w.ResponseWriter.WriteHeader(code)
 }
 
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	w.writeStarted(http.StatusOK)
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+type writerOnly struct {
+	io.Writer
+}
+
+func (w *ResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		w.writeStarted(http.StatusOK)
+		n, err := rf.ReadFrom(r)
+		w.bytesWritten += n
+		return n, err
+	}
+	return io.Copy(writerOnly{w}, r)
+}
+
+func (w *ResponseWriter) BytesWritten() int64 {
+	return w.bytesWritten
+}
+
+// TimeToFirstByte returns the time from the creation of the writer until the
+// response header was written or zero if nothing was written yet.
+func (w *ResponseWriter) TimeToFirstByte() time.Duration {
+	return w.timeToFirstByte
+}
+
+// WrittenHeader returns the header as it was sent to the client or nil if the
+// header was not written yet.
+func (w *ResponseWriter) WrittenHeader() http.Header {
+	return w.header
+}
+
+func (w *ResponseWriter) SetRoute(route string) {
+	w.route = route
+}
+
+func (w *ResponseWriter) Route() string {
+	return w.route
+}
+
 func (w *ResponseWriter) StatusCode() int {
+	if w.hijacked && w.statusCode == 0 {
+		return http.StatusSwitchingProtocols
+	}
 	if w.statusCode == 0 {
 		return 200
 	}
 	return w.statusCode
 }
 
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		conn, rw, err := h.Hijack()
+		if err == nil {
+			w.hijacked = true
+		}
+		return conn, rw, err
+	}
+	return nil, nil, errHijackNotSupported
+}
+
+func (w *ResponseWriter) Hijacked() bool {
+	return w.hijacked
+}
+
+func (w *ResponseWriter) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
 func (w *ResponseWriter) CloseNotify() <-chan bool {
 	if n, ok := w.ResponseWriter.(http.CloseNotifier); ok {
 		return n.CloseNotify()
@@ -39,6 +142,7 @@ func (w *ResponseWriter) CloseNotify() <-chan bool {
 
 func (w *ResponseWriter) Flush() {
 	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.writeStarted(http.StatusOK)
 		f.Flush()
 	}
 }
@@ -1,8 +1,12 @@
 package httpservice_test
 
 import (
+	"bufio"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -59,6 +63,77 @@ func TestResponseWriterWrite(t *testing.T) {
 	assert.Equal(t, "hello", r.Body.String())
 }
 
+func TestResponseWriterBytesWritten(t *testing.T) {
+	w, _ := newTestingResponseWriter()
+	w.Write([]byte("hello"))
+	w.Write([]byte(" world"))
+	assert.Equal(t, int64(11), w.BytesWritten())
+}
+
+func TestResponseWriterReadFrom(t *testing.T) {
+	w, r := newTestingResponseWriter()
+	n, err := w.ReadFrom(strings.NewReader("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, int64(5), w.BytesWritten())
+	assert.Equal(t, "hello", r.Body.String())
+}
+
+func TestResponseWriterWrittenHeader(t *testing.T) {
+	w, _ := newTestingResponseWriter()
+	assert.Nil(t, w.WrittenHeader())
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("hello"))
+	w.Header().Set("X-Late", "ignored")
+	assert.Equal(t, "text/plain", w.WrittenHeader().Get("Content-Type"))
+	assert.Equal(t, "", w.WrittenHeader().Get("X-Late"))
+}
+
+func TestResponseWriterTimeToFirstByte(t *testing.T) {
+	w, _ := newTestingResponseWriter()
+	assert.Equal(t, time.Duration(0), w.TimeToFirstByte())
+	time.Sleep(time.Millisecond)
+	w.WriteHeader(http.StatusNoContent)
+	assert.True(t, w.TimeToFirstByte() >= time.Millisecond)
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		w := httpservice.NewResponseWriter(rw)
+		conn, buf, err := w.Hijack()
+		assert.NoError(t, err)
+		defer conn.Close()
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\n\r\nhijacked")
+		buf.Flush()
+		assert.True(t, w.Hijacked())
+		assert.Equal(t, http.StatusSwitchingProtocols, w.StatusCode())
+	}))
+	defer ts.Close()
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	br := bufio.NewReader(conn)
+	res, err := http.ReadResponse(br, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	content, _ := ioutil.ReadAll(br)
+	assert.Equal(t, "hijacked", string(content))
+}
+
+func TestResponseWriterNonHijacker(t *testing.T) {
+	w := httpservice.NewResponseWriter(NoopResponseWriter{})
+	_, _, err := w.Hijack()
+	assert.Error(t, err)
+	assert.False(t, w.Hijacked())
+}
+
+func TestResponseWriterNonPusher(t *testing.T) {
+	w := httpservice.NewResponseWriter(NoopResponseWriter{})
+	assert.Equal(t, http.ErrNotSupported, w.Push("/style.css", nil))
+}
+
 type ClosableResponseWriter struct {
 	c chan bool
 }
@@ -1,11 +1,11 @@
 package httpservice
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/arjantop/saola"
 	"github.com/julienschmidt/httprouter"
-	"golang.org/x/net/context"
 )
 
 type key int
@@ -68,6 +68,17 @@ func GetParams(ctx context.Context) Params {
 	return EmptyParams()
 }
 
+const routeKey key = 3
+
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey, route)
+}
+
+func GetRoute(ctx context.Context) string {
+	route, _ := ctx.Value(routeKey).(string)
+	return route
+}
+
 type HttpService interface {
 	DoHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) error
 	saola.Service
@@ -99,34 +110,35 @@ func NewEndpoint() *Endpoint {
 }
 
 func (e *Endpoint) GET(path string, s saola.Service) {
-	e.router.GET(path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		cctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		ctx := WithParams(WithServerRequest(cctx, w, r), Params{p})
-		s.Do(ctx)
-	})
+	e.router.GET(path, e.handle(path, s))
 }
 
 func (e *Endpoint) POST(path string, s saola.Service) {
-	e.router.POST(path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		cctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		ctx := WithParams(WithServerRequest(cctx, w, r), Params{p})
-		s.Do(ctx)
-	})
+	e.router.POST(path, e.handle(path, s))
 }
 
 func (e *Endpoint) PUT(path string, s saola.Service) {
-	e.router.PUT(path, func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		cctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		ctx := WithParams(WithServerRequest(cctx, w, r), Params{p})
+	e.router.PUT(path, e.handle(path, s))
+}
+
+func (e *Endpoint) OPTIONS(path string, s saola.Service) {
+	e.router.OPTIONS(path, e.handle(path, s))
+}
+
+func (e *Endpoint) handle(path string, s saola.Service) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if ri, ok := w.(RouteInterceptor); ok {
+			ri.SetRoute(path)
+		}
+		ctx := WithRoute(WithParams(WithServerRequest(r.Context(), w, r), Params{p}), path)
 		s.Do(ctx)
-	})
+	}
 }
 
-func (e *Endpoint) DoHTTP(_ context.Context, w http.ResponseWriter, r *http.Request) error {
-	e.router.ServeHTTP(w, r)
+// DoHTTP routes the request. The routes are served with the given context so
+// that the values set by the outer filters are visible to them.
+func (e *Endpoint) DoHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	e.router.ServeHTTP(w, r.WithContext(ctx))
 	return nil
 }
 
@@ -140,9 +152,7 @@ func (e *Endpoint) Name() string {
 
 func Serve(addr string, s saola.Service) error {
 	return http.ListenAndServe(addr, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-		ctx := WithServerRequest(cctx, NewResponseWriter(w), r)
+		ctx := WithServerRequest(r.Context(), NewResponseWriter(w), r)
 		s.Do(ctx)
 	}))
 }
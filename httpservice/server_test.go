@@ -1,6 +1,7 @@
 package httpservice_test
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,7 +9,6 @@ import (
 
 	"github.com/arjantop/saola/httpservice"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func TestServerParamsInContext(t *testing.T) {
@@ -103,3 +103,44 @@ func TestServerEndpointService(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "response", w.Body.String())
 }
+
+func TestServerEndpointOPTIONS(t *testing.T) {
+	endpoint := httpservice.NewEndpoint()
+	endpoint.OPTIONS("/hello/:name", httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		w.Header().Set("Allow", "GET, OPTIONS")
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}))
+
+	req, err := http.NewRequest("OPTIONS", "http://example.com/hello/john", nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	endpoint.DoHTTP(context.Background(), w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestServerEndpointContext(t *testing.T) {
+	var requestID string
+	var ctxErr error
+	endpoint := httpservice.NewEndpoint()
+	endpoint.GET("/hello", httpservice.FuncService(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		requestID = httpservice.GetRequestID(ctx)
+		ctxErr = ctx.Err()
+		return nil
+	}))
+
+	rctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequest("GET", "http://example.com/hello", nil)
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	ctx := httpservice.WithServerRequest(httpservice.WithRequestID(rctx, "abc"), w, req)
+	endpoint.Do(ctx)
+
+	assert.Equal(t, "abc", requestID)
+	assert.Equal(t, context.Canceled, ctxErr)
+}
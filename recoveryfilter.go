@@ -1,9 +1,8 @@
 package saola
 
 import (
+	"context"
 	"fmt"
-
-	"golang.org/x/net/context"
 )
 
 func NewRecoveryFilter() Filter {
@@ -16,3 +15,17 @@ func NewRecoveryFilter() Filter {
 		return s.Do(ctx)
 	})
 }
+
+// NewRecoveryFlt is the typed version of NewRecoveryFilter. The zero response
+// is returned with the error.
+func NewRecoveryFlt[Req, Rep any]() Flt[Req, Rep] {
+	return func(ctx context.Context, req Req, s Svc[Req, Rep]) (rep Rep, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				var zero Rep
+				rep, err = zero, fmt.Errorf("panic: %s", r)
+			}
+		}()
+		return s.Call(ctx, req)
+	}
+}
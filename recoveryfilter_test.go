@@ -1,12 +1,12 @@
 package saola_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 
 	"github.com/arjantop/saola"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func recoveryService(action string) saola.Service {
@@ -33,3 +33,12 @@ func TestRecoverFilterError(t *testing.T) {
 	err := s.Do(context.Background())
 	assert.Equal(t, errors.New("error"), err, "Only in the case of a panic there are be side-effects")
 }
+
+func TestRecoveryFltPanic(t *testing.T) {
+	s := saola.NewRecoveryFlt[int, string]().Apply(saola.FuncSvc[int, string](func(ctx context.Context, req int) (string, error) {
+		panic("original")
+	}))
+	rep, err := s.Call(context.Background(), 1)
+	assert.Equal(t, errors.New("panic: original"), err)
+	assert.Equal(t, "", rep)
+}
@@ -1,18 +1,23 @@
 package redisservice
 
 import (
+	"context"
 	"io"
 	"sync"
 	"time"
 
 	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/stats"
 	"github.com/garyburd/redigo/redis"
-	"golang.org/x/net/context"
 )
 
 type Client interface {
 	Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error)
 	Send(ctx context.Context, cmd string, args ...interface{}) error
+	// Pipeline sends the commands in one batch and sets their results.
+	Pipeline(ctx context.Context, cmds ...*Cmd) error
+	// Transaction executes the commands atomically in MULTI/EXEC.
+	Transaction(ctx context.Context, cmds ...*Cmd) error
 	io.Closer
 }
 
@@ -20,6 +25,9 @@ type Pool struct {
 	Filter  saola.Filter
 	service saola.Service
 
+	// Dial creates the connections of the pool. The deadline of the context
+	// of a command bounds reading its reply, writing the command is bounded
+	// only by the write timeout of the connection (see redis.DialWriteTimeout).
 	Dial func() (redis.Conn, error)
 
 	TestOnBorrow func(redis.Conn, time.Time) error
@@ -29,21 +37,29 @@ type Pool struct {
 
 	IdleTimeout time.Duration
 
+	// Stats receives the metrics of the pool under <service>.pool and of the
+	// commands under <service>.command (see NewCommandStatsFilter).
+	Stats stats.StatsReceiver
+
 	lock     sync.Mutex
 	implPool *redis.Pool
+	released chan struct{}
 }
 
 func (p *Pool) pool() *redis.Pool {
 	p.lock.Lock()
 	if p.implPool == nil {
 		p.service = redisService{}
+		if p.Stats != nil {
+			p.service = saola.Apply(p.service, NewCommandStatsFilter(p.Stats))
+		}
 		if p.Filter != nil {
 			p.service = saola.Apply(p.service, p.Filter)
 		}
 
 		p.implPool = &redis.Pool{
-			Dial:         p.Dial,
-			TestOnBorrow: p.TestOnBorrow,
+			Dial:         p.dial(),
+			TestOnBorrow: p.testOnBorrow(),
 			MaxIdle:      p.MaxIdle,
 			MaxActive:    p.MaxActive,
 			IdleTimeout:  p.IdleTimeout,
@@ -55,22 +71,189 @@ func (p *Pool) pool() *redis.Pool {
 }
 
 func (p *Pool) Close() error {
-	return p.implPool.Close()
+	p.lock.Lock()
+	impl := p.implPool
+	p.lock.Unlock()
+	if impl == nil {
+		return nil
+	}
+	err := impl.Close()
+	// Waiting GetContext calls fail on the closed pool.
+	p.release()
+	return err
 }
 
 func (p *Pool) Get() Client {
+	conn := p.pool().Get()
+	return p.client(conn)
+}
+
+// GetContext returns a connection from the pool. When MaxActive connections
+// are in use it waits until one is returned to the pool or the context is
+// done.
+func (p *Pool) GetContext(ctx context.Context) (Client, error) {
+	impl := p.pool()
+	start := time.Now()
+	exhausted := false
+	for {
+		released := p.releasedChan()
+		conn, err := impl.GetContext(ctx)
+		if err != redis.ErrPoolExhausted {
+			if p.Stats != nil {
+				p.poolStats().Timer("wait").Add(time.Now().Sub(start))
+			}
+			if err != nil {
+				return nil, err
+			}
+			return p.client(conn), nil
+		}
+		if !exhausted && p.Stats != nil {
+			p.poolStats().Counter("exhausted").Incr()
+		}
+		exhausted = true
+		select {
+		case <-released:
+		case <-ctx.Done():
+			if p.Stats != nil {
+				p.poolStats().Counter("wait_timeout").Incr()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Client returns a Client executing each call on a connection from the pool,
+// so a broken connection only fails the calls made on it. Commands that
+// depend on the connection, like WATCH, need a connection from Get. Closing
+// the client does not close the pool.
+func (p *Pool) Client() Client {
+	return poolClient{p}
+}
+
+type poolClient struct {
+	pool *Pool
+}
+
+func (c poolClient) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.Do(ctx, cmd, args...)
+}
+
+func (c poolClient) Send(ctx context.Context, cmd string, args ...interface{}) error {
+	return errSendNotSupported
+}
+
+func (c poolClient) Pipeline(ctx context.Context, cmds ...*Cmd) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Pipeline(ctx, cmds...)
+}
+
+func (c poolClient) Transaction(ctx context.Context, cmds ...*Cmd) error {
+	conn, err := c.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Transaction(ctx, cmds...)
+}
+
+func (c poolClient) Close() error {
+	return nil
+}
+
+func (p *Pool) client(conn redis.Conn) Client {
+	p.updateGauges()
 	return &connClient{
+		pool:    p,
 		service: p.service,
-		conn:    p.pool().Get(),
+		conn:    &syncConn{pool: p, Conn: conn},
+	}
+}
+
+func (p *Pool) poolStats() stats.StatsReceiver {
+	return p.Stats.Scope(p.service.Name()).Scope("pool")
+}
+
+// releasedChan returns a channel that is closed when a connection is
+// returned to the pool.
+func (p *Pool) releasedChan() <-chan struct{} {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.released == nil {
+		p.released = make(chan struct{})
+	}
+	return p.released
+}
+
+func (p *Pool) release() {
+	p.lock.Lock()
+	if p.released != nil {
+		close(p.released)
+		p.released = nil
+	}
+	p.lock.Unlock()
+	p.updateGauges()
+}
+
+// syncConn serializes the use of a connection so that an abandoned request
+// (e.g. a losing hedged attempt) finishes before the next one starts.
+type syncConn struct {
+	lock sync.Mutex
+	pool *Pool
+	redis.Conn
+}
+
+func (c *syncConn) Do(cmd string, args ...interface{}) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.Conn.Do(cmd, args...)
+}
+
+func (c *syncConn) Send(cmd string, args ...interface{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.Conn.Send(cmd, args...)
+}
+
+func (c *syncConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *syncConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *syncConn) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	err := c.Conn.Close()
+	if c.pool != nil {
+		c.pool.release()
 	}
+	return err
 }
 
 type ClientRequest struct {
+	pool        *Pool
 	conn        redis.Conn
 	requestType requestType
 	Command     string
 	Args        []interface{}
-	Response    interface{}
+	// Commands of a pipeline or a transaction.
+	Commands []*Cmd
+	Response interface{}
 }
 
 func GetClientRequest(ctx context.Context) *ClientRequest {
@@ -80,18 +263,89 @@ func GetClientRequest(ctx context.Context) *ClientRequest {
 
 type requestKey struct{}
 
+// errTimeoutNotSupported is returned by redigo for connections that do not
+// implement redis.ConnWithTimeout.
+var _, errTimeoutNotSupported = redis.DoWithTimeout(struct{ redis.Conn }{}, 0, "")
+
+// timeout returns the time remaining until the deadline of the context, the
+// connection timeouts are used when there is no deadline.
+func timeout(ctx context.Context) (time.Duration, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, false, err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false, nil
+	}
+	d := deadline.Sub(time.Now())
+	if d <= 0 {
+		return 0, false, context.DeadlineExceeded
+	}
+	return d, true, nil
+}
+
+// contextError returns the error of the context for timeouts caused by its
+// deadline.
+func contextError(ctx context.Context, err error) error {
+	if e, ok := err.(interface{ Timeout() bool }); !ok || !e.Timeout() {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	// The read deadline can expire before the timer of the context.
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return context.DeadlineExceeded
+	}
+	return err
+}
+
+// doContext bounds the reply by the deadline of the context. redigo does not
+// support write deadlines per command so writes use the connection timeout.
+func doContext(ctx context.Context, conn redis.Conn, cmd string, args ...interface{}) (interface{}, error) {
+	d, ok, err := timeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		r, err := redis.DoWithTimeout(conn, d, cmd, args...)
+		if err != errTimeoutNotSupported {
+			return r, contextError(ctx, err)
+		}
+	}
+	return conn.Do(cmd, args...)
+}
+
+func receiveContext(ctx context.Context, conn redis.Conn) (interface{}, error) {
+	d, ok, err := timeout(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		r, err := redis.ReceiveWithTimeout(conn, d)
+		if err != errTimeoutNotSupported {
+			return r, contextError(ctx, err)
+		}
+	}
+	return conn.Receive()
+}
+
 type redisService struct{}
 
 func (rs redisService) Do(ctx context.Context) error {
 	req := GetClientRequest(ctx)
 	switch req.requestType {
 	case Do:
-		r, err := req.conn.Do(req.Command, req.Args...)
+		r, err := doContext(ctx, req.conn, req.Command, req.Args...)
 		req.Response = r
 		return err
 	case Send:
 		err := req.conn.Send(req.Command, req.Args...)
 		return err
+	case Pipeline:
+		return doPipeline(ctx, req)
+	case Transaction:
+		return doTransaction(ctx, req)
 	}
 	return nil
 }
@@ -101,6 +355,7 @@ func (rs redisService) Name() string {
 }
 
 type connClient struct {
+	pool    *Pool
 	service saola.Service
 
 	conn redis.Conn
@@ -109,12 +364,15 @@ type connClient struct {
 type requestType int
 
 const (
-	Do   requestType = iota
-	Send requestType = iota
+	Do          requestType = iota
+	Send        requestType = iota
+	Pipeline    requestType = iota
+	Transaction requestType = iota
 )
 
 func (c *connClient) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
 	r := &ClientRequest{
+		pool:        c.pool,
 		conn:        c.conn,
 		requestType: Do,
 		Command:     cmd,
@@ -126,6 +384,7 @@ func (c *connClient) Do(ctx context.Context, cmd string, args ...interface{}) (i
 
 func (c *connClient) Send(ctx context.Context, cmd string, args ...interface{}) error {
 	r := &ClientRequest{
+		pool:        c.pool,
 		conn:        c.conn,
 		requestType: Send,
 		Command:     cmd,
@@ -135,6 +394,25 @@ func (c *connClient) Send(ctx context.Context, cmd string, args ...interface{})
 	return err
 }
 
+func (c *connClient) Pipeline(ctx context.Context, cmds ...*Cmd) error {
+	return c.batch(ctx, Pipeline, "PIPELINE", cmds)
+}
+
+func (c *connClient) Transaction(ctx context.Context, cmds ...*Cmd) error {
+	return c.batch(ctx, Transaction, "MULTI", cmds)
+}
+
+func (c *connClient) batch(ctx context.Context, t requestType, cmd string, cmds []*Cmd) error {
+	r := &ClientRequest{
+		pool:        c.pool,
+		conn:        c.conn,
+		requestType: t,
+		Command:     cmd,
+		Commands:    cmds,
+	}
+	return c.service.Do(context.WithValue(ctx, requestKey{}, r))
+}
+
 func (c *connClient) Close() error {
 	return c.conn.Close()
 }
@@ -1,12 +1,16 @@
 package redisservice_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/arjantop/saola"
 	"github.com/arjantop/saola/redisservice"
+	"github.com/arjantop/saola/redisservice/redistest"
+	"github.com/arjantop/saola/stats/statstest"
 	"github.com/garyburd/redigo/redis"
-	"golang.org/x/net/context"
+	"github.com/stretchr/testify/assert"
 )
 
 type MockConn struct {
@@ -113,6 +117,9 @@ func TestPoolFilter(t *testing.T) {
 	if rs, ok := r.(string); !ok || rs != "response" {
 		t.Error("filter should be executed")
 	}
+	if !isGetCommand {
+		t.Error("filter should change the command")
+	}
 }
 
 func TestPoolClose(t *testing.T) {
@@ -154,3 +161,113 @@ func TestPoolGetMaxActive(t *testing.T) {
 		t.Error("connection above MaxActive should always return an error")
 	}
 }
+
+func TestPoolGetContextWait(t *testing.T) {
+	r := statstest.NewRecorder()
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return &MockConn{}, nil
+		},
+		MaxActive: 1,
+		Stats:     r,
+	}
+	conn, err := pool.GetContext(context.Background())
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		conn.Close()
+	}()
+	conn, err = pool.GetContext(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Send(context.Background(), "GET", "key"))
+	assert.Equal(t, int64(1), r.CounterValue("redis.pool.exhausted"))
+	assert.True(t, r.TimerValue("redis.pool.wait") >= 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pool.GetContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, int64(2), r.CounterValue("redis.pool.exhausted"))
+	assert.Equal(t, int64(1), r.CounterValue("redis.pool.wait_timeout"))
+}
+
+func TestPoolDoContext(t *testing.T) {
+	var sent bool
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return &MockConn{
+				DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+					sent = true
+					return "OK", nil
+				},
+			}, nil
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := conn.Do(ctx, "SET", "key", "value")
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", r)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	sent = false
+	_, err = conn.Do(ctx, "SET", "key", "value")
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, sent)
+}
+
+func TestPoolServerFaults(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	pool := redisservice.Pool{Dial: s.Dial, MaxIdle: 1}
+	defer pool.Close()
+	ctx := context.Background()
+
+	conn := pool.Get()
+	_, err := conn.Do(ctx, "SET", "key", "value")
+	assert.NoError(t, err)
+	conn.Close()
+
+	s.Inject(redistest.Fault{Command: "GET", Delay: 100 * time.Millisecond, Times: 1})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	conn = pool.Get()
+	_, err = conn.Do(timeoutCtx, "GET", "key")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	conn.Close()
+
+	s.Inject(redistest.Fault{Command: "GET", Drop: true, Times: 1})
+	conn = pool.Get()
+	_, err = conn.Do(ctx, "GET", "key")
+	assert.Error(t, err)
+	conn.Close()
+
+	conn = pool.Get()
+	defer conn.Close()
+	v, err := redis.String(conn.Do(ctx, "GET", "key"))
+	assert.NoError(t, err, "broken connections should not be reused")
+	assert.Equal(t, "value", v)
+}
+
+func TestPoolClient(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	pool := redisservice.Pool{Dial: s.Dial, MaxIdle: 1}
+	defer pool.Close()
+	c := pool.Client()
+	ctx := context.Background()
+
+	_, err := c.Do(ctx, "SET", "key", "value")
+	assert.NoError(t, err)
+	s.Inject(redistest.Fault{Drop: true, Times: 1})
+	_, err = c.Do(ctx, "GET", "key")
+	assert.Error(t, err)
+	v, err := redis.String(c.Do(ctx, "GET", "key"))
+	assert.NoError(t, err, "broken connection should be replaced")
+	assert.Equal(t, "value", v)
+	assert.Error(t, c.Send(ctx, "GET", "key"))
+}
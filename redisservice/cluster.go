@@ -0,0 +1,478 @@
+package redisservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const clusterSlots = 16384
+
+var (
+	errSendNotSupported = errors.New("redis: Send is not supported, use Pipeline")
+	errNoClusterNodes   = errors.New("redis: no cluster nodes")
+)
+
+// Slot returns the hash slot of the key. Only the part between the first {
+// and the following } is hashed when it is not empty, so keys with the same
+// hash tag belong to the same slot.
+func Slot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 implements CRC16-CCITT (XMODEM) used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// keylessCommands can be sent to any node.
+var keylessCommands = map[string]bool{
+	"AUTH":      true,
+	"CLIENT":    true,
+	"CLUSTER":   true,
+	"COMMAND":   true,
+	"CONFIG":    true,
+	"DBSIZE":    true,
+	"ECHO":      true,
+	"FLUSHALL":  true,
+	"FLUSHDB":   true,
+	"INFO":      true,
+	"KEYS":      true,
+	"LASTSAVE":  true,
+	"PING":      true,
+	"PUBLISH":   true,
+	"RANDOMKEY": true,
+	"ROLE":      true,
+	"SCAN":      true,
+	"SCRIPT":    true,
+	"SLOWLOG":   true,
+	"TIME":      true,
+}
+
+// commandKey returns the first key of the command, assumed to be the first
+// argument except for scripts and the keyless commands.
+func commandKey(cmd string, args []interface{}) (string, bool) {
+	cmd = strings.ToUpper(cmd)
+	if keylessCommands[cmd] {
+		return "", false
+	}
+	switch cmd {
+	case "EVAL", "EVALSHA":
+		if len(args) < 3 {
+			return "", false
+		}
+		if n, err := strconv.Atoi(argString(args[1])); err != nil || n == 0 {
+			return "", false
+		}
+		args = args[2:]
+	}
+	if len(args) == 0 {
+		return "", false
+	}
+	return argString(args[0]), true
+}
+
+func argString(arg interface{}) string {
+	switch a := arg.(type) {
+	case string:
+		return a
+	case []byte:
+		return string(a)
+	default:
+		return fmt.Sprint(a)
+	}
+}
+
+type redirect struct {
+	ask  bool
+	slot int
+	addr string
+}
+
+// parseRedirect parses the MOVED and ASK errors returned for the keys served
+// by another node.
+func parseRedirect(err error) (redirect, bool) {
+	e, ok := err.(redis.Error)
+	if !ok {
+		return redirect{}, false
+	}
+	parts := strings.Fields(string(e))
+	if len(parts) != 3 || (parts[0] != "MOVED" && parts[0] != "ASK") {
+		return redirect{}, false
+	}
+	slot, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return redirect{}, false
+	}
+	return redirect{parts[0] == "ASK", slot, parts[2]}, true
+}
+
+func parseClusterSlots(reply interface{}) ([]string, error) {
+	ranges, err := redis.Values(reply, nil)
+	if err != nil {
+		return nil, err
+	}
+	slots := make([]string, clusterSlots)
+	for _, r := range ranges {
+		values, err := redis.Values(r, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) < 3 {
+			return nil, errors.New("redis: invalid CLUSTER SLOTS reply")
+		}
+		start, err := redis.Int(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		end, err := redis.Int(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		master, err := redis.Values(values[2], nil)
+		if err != nil || len(master) < 2 {
+			return nil, errors.New("redis: invalid CLUSTER SLOTS node")
+		}
+		host, err := redis.String(master[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		port, err := redis.Int(master[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		for s := start; s <= end && s < clusterSlots; s++ {
+			slots[s] = addr
+		}
+	}
+	return slots, nil
+}
+
+// Cluster is a Client of Redis Cluster. Commands are routed to the master
+// owning the hash slot of their first key, following the MOVED and ASK
+// redirects. The commands go through the filter of the Pool of each node.
+type Cluster struct {
+	// Addrs are the seed nodes used to discover the slots.
+	Addrs []string
+	// NewPool creates the pool of the node, by default the connections are
+	// dialed with TCP.
+	NewPool func(addr string) *Pool
+	// MaxRedirects is the maximum number of redirects followed by a command,
+	// defaults to 5.
+	MaxRedirects int
+	// ConnectTimeout, ReadTimeout and WriteTimeout are the timeouts of the
+	// connections of the default pools, 3s by default.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	lock       sync.RWMutex
+	slots      []string
+	pools      map[string]*Pool
+	refreshing int32
+}
+
+func (c *Cluster) maxRedirects() int {
+	if c.MaxRedirects <= 0 {
+		return 5
+	}
+	return c.MaxRedirects
+}
+
+func (c *Cluster) pool(addr string) *Pool {
+	c.lock.RLock()
+	p, ok := c.pools[addr]
+	c.lock.RUnlock()
+	if ok {
+		return p
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if p, ok := c.pools[addr]; ok {
+		return p
+	}
+	if c.NewPool != nil {
+		p = c.NewPool(addr)
+	} else {
+		p = &Pool{
+			Dial: func() (redis.Conn, error) {
+				return redis.Dial("tcp", addr,
+					redis.DialConnectTimeout(timeoutOrDefault(c.ConnectTimeout)),
+					redis.DialReadTimeout(timeoutOrDefault(c.ReadTimeout)),
+					redis.DialWriteTimeout(timeoutOrDefault(c.WriteTimeout)))
+			},
+			MaxIdle: 3,
+		}
+	}
+	if c.pools == nil {
+		c.pools = make(map[string]*Pool)
+	}
+	c.pools[addr] = p
+	return p
+}
+
+// Refresh reloads the slots from the first node that replies to CLUSTER
+// SLOTS.
+func (c *Cluster) Refresh(ctx context.Context) error {
+	c.lock.RLock()
+	addrs := make([]string, 0, len(c.pools)+len(c.Addrs))
+	for addr := range c.pools {
+		addrs = append(addrs, addr)
+	}
+	c.lock.RUnlock()
+	addrs = append(addrs, c.Addrs...)
+	if len(addrs) == 0 {
+		return errNoClusterNodes
+	}
+
+	err := errNoClusterNodes
+	for _, addr := range addrs {
+		var reply interface{}
+		reply, err = c.doNode(ctx, addr, false, "CLUSTER", "SLOTS")
+		if err != nil {
+			continue
+		}
+		var slots []string
+		if slots, err = parseClusterSlots(reply); err != nil {
+			continue
+		}
+		c.lock.Lock()
+		c.slots = slots
+		c.lock.Unlock()
+		return nil
+	}
+	return err
+}
+
+func (c *Cluster) refreshAsync() {
+	if !atomic.CompareAndSwapInt32(&c.refreshing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.refreshing, 0)
+		c.Refresh(context.Background())
+	}()
+}
+
+func (c *Cluster) setSlot(slot int, addr string) {
+	c.lock.Lock()
+	if c.slots != nil && slot >= 0 && slot < clusterSlots {
+		c.slots[slot] = addr
+	}
+	c.lock.Unlock()
+}
+
+// addr returns the node serving the key, any node for commands without keys.
+func (c *Cluster) addr(ctx context.Context, key string, hasKey bool) (string, error) {
+	c.lock.RLock()
+	loaded := c.slots != nil
+	c.lock.RUnlock()
+	if !loaded {
+		if err := c.Refresh(ctx); err != nil {
+			return "", err
+		}
+	}
+	slot := rand.Intn(clusterSlots)
+	if hasKey {
+		slot = Slot(key)
+	}
+	c.lock.RLock()
+	addr := c.slots[slot]
+	c.lock.RUnlock()
+	if addr == "" {
+		if len(c.Addrs) == 0 {
+			return "", errNoClusterNodes
+		}
+		return c.Addrs[0], nil
+	}
+	return addr, nil
+}
+
+func (c *Cluster) doNode(ctx context.Context, addr string, asking bool, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool(addr).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if asking {
+		if _, err := conn.Do(ctx, "ASKING"); err != nil {
+			return nil, err
+		}
+	}
+	return conn.Do(ctx, cmd, args...)
+}
+
+// isConnError reports whether the error is caused by the connection to the
+// node, which may have failed over.
+func isConnError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	_, isReply := err.(redis.Error)
+	return !isReply
+}
+
+func (c *Cluster) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	key, hasKey := commandKey(cmd, args)
+	addr, err := c.addr(ctx, key, hasKey)
+	if err != nil {
+		return nil, err
+	}
+	asking := false
+	for i := 0; ; i++ {
+		r, err := c.doNode(ctx, addr, asking, cmd, args...)
+		rd, ok := parseRedirect(err)
+		if !ok || i >= c.maxRedirects() {
+			if isConnError(ctx, err) {
+				c.refreshAsync()
+			}
+			return r, err
+		}
+		if !rd.ask {
+			c.setSlot(rd.slot, rd.addr)
+			c.refreshAsync()
+		}
+		addr, asking = rd.addr, rd.ask
+	}
+}
+
+func (c *Cluster) Send(ctx context.Context, cmd string, args ...interface{}) error {
+	return errSendNotSupported
+}
+
+// Pipeline sends the commands of each node in one batch. The redirected
+// commands are retried one by one.
+func (c *Cluster) Pipeline(ctx context.Context, cmds ...*Cmd) error {
+	groups := make(map[string][]*Cmd)
+	for _, cmd := range cmds {
+		key, hasKey := commandKey(cmd.Command, cmd.Args)
+		addr, err := c.addr(ctx, key, hasKey)
+		if err != nil {
+			return err
+		}
+		groups[addr] = append(groups[addr], cmd)
+	}
+
+	var wg sync.WaitGroup
+	for addr, group := range groups {
+		wg.Add(1)
+		go func(addr string, group []*Cmd) {
+			defer wg.Done()
+			conn, err := c.pool(addr).GetContext(ctx)
+			if err != nil {
+				for _, cmd := range group {
+					cmd.Response, cmd.Err = nil, err
+				}
+				return
+			}
+			// The commands without a reply get the error of the connection.
+			conn.Pipeline(ctx, group...)
+			conn.Close()
+		}(addr, group)
+	}
+	wg.Wait()
+
+	for _, cmd := range cmds {
+		if _, ok := parseRedirect(cmd.Err); ok {
+			cmd.Response, cmd.Err = c.Do(ctx, cmd.Command, cmd.Args...)
+		}
+		if isConnError(ctx, cmd.Err) {
+			c.refreshAsync()
+		}
+	}
+	return firstError(cmds)
+}
+
+// Transaction executes the commands on the node serving the key of the first
+// command, all the keys must belong to the same slot.
+func (c *Cluster) Transaction(ctx context.Context, cmds ...*Cmd) error {
+	var key string
+	var hasKey bool
+	for _, cmd := range cmds {
+		if key, hasKey = commandKey(cmd.Command, cmd.Args); hasKey {
+			break
+		}
+	}
+	addr, err := c.addr(ctx, key, hasKey)
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		conn, err := c.pool(addr).GetContext(ctx)
+		if err != nil {
+			return err
+		}
+		err = conn.Transaction(ctx, cmds...)
+		conn.Close()
+
+		var rd redirect
+		redirected := false
+		for _, cmd := range cmds {
+			if rd, redirected = parseRedirect(cmd.Err); redirected {
+				break
+			}
+		}
+		if !redirected || rd.ask || i >= c.maxRedirects() {
+			if isConnError(ctx, err) {
+				c.refreshAsync()
+			}
+			return err
+		}
+		c.setSlot(rd.slot, rd.addr)
+		c.refreshAsync()
+		addr = rd.addr
+		for _, cmd := range cmds {
+			cmd.Response, cmd.Err = nil, nil
+		}
+	}
+}
+
+// NodeClient returns a connection to the node serving the key, e.g. to watch
+// keys with Watch.
+func (c *Cluster) NodeClient(ctx context.Context, key string) (Client, error) {
+	addr, err := c.addr(ctx, key, true)
+	if err != nil {
+		return nil, err
+	}
+	return c.pool(addr).GetContext(ctx)
+}
+
+// Close closes the pools of all the nodes.
+func (c *Cluster) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var err error
+	for addr, p := range c.pools {
+		if e := p.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(c.pools, addr)
+	}
+	return err
+}
@@ -0,0 +1,339 @@
+package redisservice_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCluster is a multi-node cluster serving GET and SET that redirects the
+// commands of the keys owned by other nodes.
+type fakeCluster struct {
+	lock     sync.Mutex
+	nodes    []*fakeNode
+	owners   []int
+	asks     map[int]int
+	data     map[string]string
+	commands map[string][]string
+}
+
+type fakeNode struct {
+	cluster *fakeCluster
+	id      int
+	ln      net.Listener
+}
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	c := &fakeCluster{
+		owners:   make([]int, 16384),
+		asks:     make(map[int]int),
+		data:     make(map[string]string),
+		commands: make(map[string][]string),
+	}
+	for i := 0; i < n; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		node := &fakeNode{c, i, ln}
+		c.nodes = append(c.nodes, node)
+		go node.serve()
+	}
+	for s := range c.owners {
+		c.owners[s] = s * n / 16384
+	}
+	return c
+}
+
+func (c *fakeCluster) addr(node int) string {
+	return c.nodes[node].ln.Addr().String()
+}
+
+func (c *fakeCluster) nodeCommands(node int) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.commands[c.addr(node)]
+}
+
+func (c *fakeCluster) setOwner(slot, node int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.owners[slot] = node
+}
+
+func (c *fakeCluster) Close() {
+	for _, n := range c.nodes {
+		n.ln.Close()
+	}
+}
+
+func (n *fakeNode) serve() {
+	for {
+		conn, err := n.ln.Accept()
+		if err != nil {
+			return
+		}
+		go n.handle(conn)
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, count)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+func (n *fakeNode) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	asking := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		reply := n.reply(args, asking)
+		asking = strings.ToUpper(args[0]) == "ASKING"
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (n *fakeNode) reply(args []string, asking bool) string {
+	c := n.cluster
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	addr := c.addr(n.id)
+	c.commands[addr] = append(c.commands[addr], strings.Join(args, " "))
+
+	switch strings.ToUpper(args[0]) {
+	case "ASKING":
+		return "+OK\r\n"
+	case "CLUSTER":
+		return c.slotsReply()
+	case "GET", "SET":
+	default:
+		return "-ERR unknown command\r\n"
+	}
+
+	slot := redisservice.Slot(args[1])
+	target, migrating := c.asks[slot]
+	switch {
+	case migrating && target == n.id && asking:
+	case c.owners[slot] != n.id:
+		return fmt.Sprintf("-MOVED %d %s\r\n", slot, c.addr(c.owners[slot]))
+	case migrating:
+		return fmt.Sprintf("-ASK %d %s\r\n", slot, c.addr(target))
+	}
+
+	if strings.ToUpper(args[0]) == "SET" {
+		c.data[args[1]] = args[2]
+		return "+OK\r\n"
+	}
+	v, ok := c.data[args[1]]
+	if !ok {
+		return "$-1\r\n"
+	}
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+}
+
+func (c *fakeCluster) slotsReply() string {
+	var ranges []string
+	start := 0
+	for s := 1; s <= len(c.owners); s++ {
+		if s == len(c.owners) || c.owners[s] != c.owners[start] {
+			host, port, _ := net.SplitHostPort(c.addr(c.owners[start]))
+			ranges = append(ranges, fmt.Sprintf("*3\r\n:%d\r\n:%d\r\n*2\r\n$%d\r\n%s\r\n:%s\r\n",
+				start, s-1, len(host), host, port))
+			start = s
+		}
+	}
+	return fmt.Sprintf("*%d\r\n%s", len(ranges), strings.Join(ranges, ""))
+}
+
+// Keys served by the first and the second node of two.
+const (
+	keyNode0 = "bar"
+	keyNode1 = "foo"
+)
+
+func TestSlot(t *testing.T) {
+	assert.Equal(t, 12182, redisservice.Slot("foo"))
+	assert.Equal(t, 12739, redisservice.Slot("123456789"))
+	assert.Equal(t, redisservice.Slot("user"), redisservice.Slot("{user}.name"))
+	assert.Equal(t, redisservice.Slot("{user}.name"), redisservice.Slot("{user}.email"))
+	assert.NotEqual(t, redisservice.Slot("{}.name"), redisservice.Slot("{}.email"))
+}
+
+func TestCommandKey(t *testing.T) {
+	for _, c := range []struct {
+		cmd    string
+		args   []interface{}
+		key    string
+		hasKey bool
+	}{
+		{"GET", []interface{}{"foo"}, "foo", true},
+		{"eval", []interface{}{"script", 1, "foo", "arg"}, "foo", true},
+		{"EVAL", []interface{}{"script", 0, "arg"}, "", false},
+		{"PING", nil, "", false},
+		{"info", []interface{}{"server"}, "", false},
+		{"SCRIPT", []interface{}{"LOAD", "script"}, "", false},
+		{"CLUSTER", []interface{}{"SLOTS"}, "", false},
+	} {
+		key, hasKey := redisservice.CommandKey(c.cmd, c.args)
+		assert.Equal(t, c.key, key, c.cmd)
+		assert.Equal(t, c.hasKey, hasKey, c.cmd)
+	}
+}
+
+func TestClusterRouting(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	defer fc.Close()
+	c := &redisservice.Cluster{Addrs: []string{fc.addr(0)}}
+	defer c.Close()
+	ctx := context.Background()
+
+	_, err := c.Do(ctx, "SET", keyNode0, "a")
+	assert.NoError(t, err)
+	_, err = c.Do(ctx, "SET", keyNode1, "b")
+	assert.NoError(t, err)
+	v, err := redis.String(c.Do(ctx, "GET", keyNode1))
+	assert.NoError(t, err)
+	assert.Equal(t, "b", v)
+
+	assert.Equal(t, []string{"CLUSTER SLOTS", "SET bar a"}, fc.nodeCommands(0))
+	assert.Equal(t, []string{"SET foo b", "GET foo"}, fc.nodeCommands(1))
+}
+
+func TestClusterMoved(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	defer fc.Close()
+	c := &redisservice.Cluster{Addrs: []string{fc.addr(0)}}
+	defer c.Close()
+	ctx := context.Background()
+
+	_, err := c.Do(ctx, "SET", keyNode0, "a")
+	assert.NoError(t, err)
+
+	fc.setOwner(redisservice.Slot(keyNode0), 1)
+	v, err := redis.String(c.Do(ctx, "GET", keyNode0))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", v)
+	assert.Contains(t, fc.nodeCommands(1), "GET bar")
+
+	// The slot is updated without waiting for the refresh.
+	_, err = c.Do(ctx, "GET", keyNode0)
+	assert.NoError(t, err)
+	commands := fc.nodeCommands(1)
+	assert.Equal(t, "GET bar", commands[len(commands)-1])
+	assert.Equal(t, 2, strings.Count(strings.Join(commands, ","), "GET bar"))
+}
+
+func TestClusterAsk(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	defer fc.Close()
+	c := &redisservice.Cluster{Addrs: []string{fc.addr(0)}}
+	defer c.Close()
+	ctx := context.Background()
+
+	fc.lock.Lock()
+	fc.data[keyNode0] = "a"
+	fc.asks[redisservice.Slot(keyNode0)] = 1
+	fc.lock.Unlock()
+
+	v, err := redis.String(c.Do(ctx, "GET", keyNode0))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", v)
+	assert.Equal(t, []string{"ASKING", "GET bar"}, fc.nodeCommands(1))
+
+	// ASK does not change the slot owner.
+	c.Do(ctx, "GET", keyNode0)
+	assert.Equal(t, []string{"CLUSTER SLOTS", "GET bar", "GET bar"}, fc.nodeCommands(0))
+}
+
+func TestClusterPipeline(t *testing.T) {
+	fc := newFakeCluster(t, 2)
+	defer fc.Close()
+	c := &redisservice.Cluster{Addrs: []string{fc.addr(0)}}
+	defer c.Close()
+	ctx := context.Background()
+
+	set0 := redisservice.NewCmd("SET", keyNode0, "a")
+	set1 := redisservice.NewCmd("SET", keyNode1, "b")
+	get0 := redisservice.NewCmd("GET", keyNode0)
+	assert.NoError(t, c.Pipeline(ctx, set0, set1, get0))
+	assert.Equal(t, "OK", set0.Response)
+	assert.Equal(t, "OK", set1.Response)
+	assert.Equal(t, []byte("a"), get0.Response)
+	assert.Equal(t, []string{"CLUSTER SLOTS", "SET bar a", "GET bar"}, fc.nodeCommands(0))
+	assert.Equal(t, []string{"SET foo b"}, fc.nodeCommands(1))
+
+	fc.setOwner(redisservice.Slot(keyNode1), 0)
+	get1 := redisservice.NewCmd("GET", keyNode1)
+	assert.NoError(t, c.Pipeline(ctx, get1))
+	assert.Equal(t, []byte("b"), get1.Response)
+}
+
+func TestClusterSendNotSupported(t *testing.T) {
+	c := &redisservice.Cluster{}
+	assert.Error(t, c.Send(context.Background(), "GET", "key"))
+}
+
+func TestClusterReadTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		// Accepts the connections but never replies.
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	c := &redisservice.Cluster{
+		Addrs:       []string{ln.Addr().String()},
+		ReadTimeout: 20 * time.Millisecond,
+	}
+	defer c.Close()
+	start := time.Now()
+	assert.Error(t, c.Refresh(context.Background()))
+	assert.True(t, time.Now().Sub(start) < time.Second, "unresponsive node should time out")
+}
@@ -0,0 +1,371 @@
+package redisservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Commands wraps a Client with typed redis commands. The commands are sent
+// with Client.Do so they go through the filter of the pool. Commands of
+// missing keys return redis.ErrNil.
+type Commands struct {
+	Client
+}
+
+func NewCommands(c Client) Commands {
+	return Commands{c}
+}
+
+// milliseconds returns the duration in milliseconds. Positive durations
+// shorter than a millisecond are rounded up as redis rejects an expiration of
+// 0.
+func milliseconds(d time.Duration) int64 {
+	if d > 0 && d < time.Millisecond {
+		return 1
+	}
+	return int64(d / time.Millisecond)
+}
+
+func durationArgs(args []interface{}, expiration time.Duration) []interface{} {
+	if expiration > 0 {
+		args = append(args, "PX", milliseconds(expiration))
+	}
+	return args
+}
+
+func keyArgs(key string, values ...interface{}) []interface{} {
+	return append([]interface{}{key}, values...)
+}
+
+func stringArgs(ss []string) []interface{} {
+	args := make([]interface{}, len(ss))
+	for i, s := range ss {
+		args[i] = s
+	}
+	return args
+}
+
+// Strings
+
+func (c Commands) Get(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "GET", key))
+}
+
+// Set sets the value of the key, it does not expire when expiration is 0.
+func (c Commands) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	_, err := c.Do(ctx, "SET", durationArgs([]interface{}{key, value}, expiration)...)
+	return err
+}
+
+// SetNX sets the value of the key only if it does not exist and reports
+// whether it was set.
+func (c Commands) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	r, err := c.Do(ctx, "SET", append(durationArgs([]interface{}{key, value}, expiration), "NX")...)
+	if err != nil {
+		return false, err
+	}
+	return r != nil, nil
+}
+
+func (c Commands) MGet(ctx context.Context, keys ...string) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "MGET", stringArgs(keys)...))
+}
+
+func (c Commands) MSet(ctx context.Context, pairs map[string]interface{}) error {
+	_, err := c.Do(ctx, "MSET", redis.Args{}.AddFlat(pairs)...)
+	return err
+}
+
+func (c Commands) Incr(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "INCR", key))
+}
+
+func (c Commands) IncrBy(ctx context.Context, key string, n int64) (int64, error) {
+	return redis.Int64(c.Do(ctx, "INCRBY", key, n))
+}
+
+func (c Commands) Decr(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "DECR", key))
+}
+
+// Keys
+
+func (c Commands) Del(ctx context.Context, keys ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "DEL", stringArgs(keys)...))
+}
+
+func (c Commands) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "EXISTS", stringArgs(keys)...))
+}
+
+// Expire sets the expiration of the key with millisecond precision and
+// reports whether the key exists.
+func (c Commands) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return redis.Bool(c.Do(ctx, "PEXPIRE", key, milliseconds(expiration)))
+}
+
+func (c Commands) Persist(ctx context.Context, key string) (bool, error) {
+	return redis.Bool(c.Do(ctx, "PERSIST", key))
+}
+
+// TTL returns the remaining time to live of the key, -1 if the key does not
+// expire and -2 if it does not exist (as returned by redis).
+func (c Commands) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := redis.Int64(c.Do(ctx, "PTTL", key))
+	if err != nil {
+		return 0, err
+	}
+	if ms < 0 {
+		return time.Duration(ms), nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Hashes
+
+func (c Commands) HGet(ctx context.Context, key, field string) (string, error) {
+	return redis.String(c.Do(ctx, "HGET", key, field))
+}
+
+// HSet sets the value of the field and reports whether the field is new.
+func (c Commands) HSet(ctx context.Context, key, field string, value interface{}) (bool, error) {
+	return redis.Bool(c.Do(ctx, "HSET", key, field, value))
+}
+
+func (c Commands) HMSet(ctx context.Context, key string, fields map[string]interface{}) error {
+	_, err := c.Do(ctx, "HMSET", redis.Args{key}.AddFlat(fields)...)
+	return err
+}
+
+func (c Commands) HMGet(ctx context.Context, key string, fields ...string) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "HMGET", keyArgs(key, stringArgs(fields)...)...))
+}
+
+func (c Commands) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	return redis.StringMap(c.Do(ctx, "HGETALL", key))
+}
+
+func (c Commands) HDel(ctx context.Context, key string, fields ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "HDEL", keyArgs(key, stringArgs(fields)...)...))
+}
+
+func (c Commands) HExists(ctx context.Context, key, field string) (bool, error) {
+	return redis.Bool(c.Do(ctx, "HEXISTS", key, field))
+}
+
+func (c Commands) HIncrBy(ctx context.Context, key, field string, n int64) (int64, error) {
+	return redis.Int64(c.Do(ctx, "HINCRBY", key, field, n))
+}
+
+// Lists
+
+func (c Commands) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "LPUSH", keyArgs(key, values...)...))
+}
+
+func (c Commands) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "RPUSH", keyArgs(key, values...)...))
+}
+
+func (c Commands) LPop(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "LPOP", key))
+}
+
+func (c Commands) RPop(ctx context.Context, key string) (string, error) {
+	return redis.String(c.Do(ctx, "RPOP", key))
+}
+
+func (c Commands) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "LRANGE", key, start, stop))
+}
+
+func (c Commands) LLen(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "LLEN", key))
+}
+
+func (c Commands) LTrim(ctx context.Context, key string, start, stop int64) error {
+	_, err := c.Do(ctx, "LTRIM", key, start, stop)
+	return err
+}
+
+// Sets
+
+func (c Commands) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "SADD", keyArgs(key, members...)...))
+}
+
+func (c Commands) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return redis.Int64(c.Do(ctx, "SREM", keyArgs(key, members...)...))
+}
+
+func (c Commands) SMembers(ctx context.Context, key string) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "SMEMBERS", key))
+}
+
+func (c Commands) SIsMember(ctx context.Context, key string, member interface{}) (bool, error) {
+	return redis.Bool(c.Do(ctx, "SISMEMBER", key, member))
+}
+
+func (c Commands) SCard(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "SCARD", key))
+}
+
+// Sorted sets
+
+// Z is a member of a sorted set.
+type Z struct {
+	Member string
+	Score  float64
+}
+
+func (c Commands) ZAdd(ctx context.Context, key string, members ...Z) (int64, error) {
+	args := make([]interface{}, 0, 1+2*len(members))
+	args = append(args, key)
+	for _, z := range members {
+		args = append(args, z.Score, z.Member)
+	}
+	return redis.Int64(c.Do(ctx, "ZADD", args...))
+}
+
+func (c Commands) ZRem(ctx context.Context, key string, members ...string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "ZREM", keyArgs(key, stringArgs(members)...)...))
+}
+
+func (c Commands) ZScore(ctx context.Context, key, member string) (float64, error) {
+	return redis.Float64(c.Do(ctx, "ZSCORE", key, member))
+}
+
+func (c Commands) ZIncrBy(ctx context.Context, key string, n float64, member string) (float64, error) {
+	return redis.Float64(c.Do(ctx, "ZINCRBY", key, n, member))
+}
+
+func (c Commands) ZCard(ctx context.Context, key string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "ZCARD", key))
+}
+
+func (c Commands) ZRank(ctx context.Context, key, member string) (int64, error) {
+	return redis.Int64(c.Do(ctx, "ZRANK", key, member))
+}
+
+func (c Commands) ZRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return redis.Strings(c.Do(ctx, "ZRANGE", key, start, stop))
+}
+
+func (c Commands) ZRangeWithScores(ctx context.Context, key string, start, stop int64) ([]Z, error) {
+	return zs(redis.Strings(c.Do(ctx, "ZRANGE", key, start, stop, "WITHSCORES")))
+}
+
+// ZRangeByScore returns the members with scores between min and max, e.g.
+// "-inf" and "(10" as accepted by redis.
+func (c Commands) ZRangeByScore(ctx context.Context, key, min, max string) ([]Z, error) {
+	return zs(redis.Strings(c.Do(ctx, "ZRANGEBYSCORE", key, min, max, "WITHSCORES")))
+}
+
+func zs(values []string, err error) ([]Z, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Z, 0, len(values)/2)
+	for i := 0; i+1 < len(values); i += 2 {
+		score, err := redis.Float64([]byte(values[i+1]), nil)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, Z{values[i], score})
+	}
+	return result, nil
+}
+
+// Scanning
+
+// ScanIterator iterates over the elements returned by the SCAN family of
+// commands. Elements of HSCAN and ZSCAN alternate between fields (members)
+// and values (scores).
+//
+//	it := cmds.Scan("user:*", 100)
+//	for it.Next(ctx) {
+//		fmt.Println(it.Val())
+//	}
+//	return it.Err()
+type ScanIterator struct {
+	cmds   Commands
+	cmd    string
+	key    string
+	args   []interface{}
+	cursor int64
+	done   bool
+	page   []string
+	val    string
+	err    error
+}
+
+func (c Commands) scan(cmd, key, match string, count int64) *ScanIterator {
+	var args []interface{}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	return &ScanIterator{cmds: c, cmd: cmd, key: key, args: args}
+}
+
+// Scan iterates over the keys matching the pattern, all the keys when match
+// is empty.
+func (c Commands) Scan(match string, count int64) *ScanIterator {
+	return c.scan("SCAN", "", match, count)
+}
+
+func (c Commands) SScan(key, match string, count int64) *ScanIterator {
+	return c.scan("SSCAN", key, match, count)
+}
+
+func (c Commands) HScan(key, match string, count int64) *ScanIterator {
+	return c.scan("HSCAN", key, match, count)
+}
+
+func (c Commands) ZScan(key, match string, count int64) *ScanIterator {
+	return c.scan("ZSCAN", key, match, count)
+}
+
+// Next advances to the next element and reports whether there is one.
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.err = it.fetch(ctx)
+	}
+	it.val, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *ScanIterator) fetch(ctx context.Context) error {
+	var args []interface{}
+	if it.key != "" {
+		args = append(args, it.key)
+	}
+	args = append(args, it.cursor)
+	args = append(args, it.args...)
+	values, err := redis.Values(it.cmds.Do(ctx, it.cmd, args...))
+	if err != nil {
+		return err
+	}
+	var page []string
+	if _, err := redis.Scan(values, &it.cursor, &page); err != nil {
+		return err
+	}
+	it.page = page
+	it.done = it.cursor == 0
+	return nil
+}
+
+func (it *ScanIterator) Val() string {
+	return it.val
+}
+
+func (it *ScanIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,144 @@
+package redisservice_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type command struct {
+	name string
+	args []interface{}
+}
+
+func mockCommands(reply func(cmd string, args ...interface{}) (interface{}, error)) (redisservice.Commands, *[]command) {
+	var commands []command
+	pool := &redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return &MockConn{
+				DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+					commands = append(commands, command{cmd, args})
+					return reply(cmd, args...)
+				},
+			}, nil
+		},
+	}
+	return redisservice.NewCommands(pool.Get()), &commands
+}
+
+func TestCommandsGetSet(t *testing.T) {
+	cmds, commands := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		switch cmd {
+		case "GET":
+			if args[0] == "missing" {
+				return nil, nil
+			}
+			return []byte("value"), nil
+		case "SET":
+			return "OK", nil
+		}
+		return nil, nil
+	})
+	ctx := context.Background()
+
+	assert.NoError(t, cmds.Set(ctx, "key", "value", 1500*time.Millisecond))
+	v, err := cmds.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+	_, err = cmds.Get(ctx, "missing")
+	assert.Equal(t, redis.ErrNil, err)
+
+	assert.Equal(t, command{"SET", []interface{}{"key", "value", "PX", int64(1500)}}, (*commands)[0])
+
+	assert.NoError(t, cmds.Set(ctx, "key", "value", 500*time.Microsecond))
+	assert.Equal(t, command{"SET", []interface{}{"key", "value", "PX", int64(1)}}, (*commands)[3])
+}
+
+func TestCommandsSetNX(t *testing.T) {
+	set := true
+	cmds, commands := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		if set {
+			return "OK", nil
+		}
+		return nil, nil
+	})
+	ok, err := cmds.SetNX(context.Background(), "key", "value", 0)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	set = false
+	ok, err = cmds.SetNX(context.Background(), "key", "value", 0)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, []interface{}{"key", "value", "NX"}, (*commands)[0].args)
+}
+
+func TestCommandsTTL(t *testing.T) {
+	cmds, _ := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		if args[0] == "persistent" {
+			return int64(-1), nil
+		}
+		return int64(2500), nil
+	})
+	ttl, err := cmds.TTL(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.Equal(t, 2500*time.Millisecond, ttl)
+	ttl, err = cmds.TTL(context.Background(), "persistent")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+}
+
+func TestCommandsHGetAll(t *testing.T) {
+	cmds, _ := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		return []interface{}{[]byte("a"), []byte("1"), []byte("b"), []byte("2")}, nil
+	})
+	m, err := cmds.HGetAll(context.Background(), "key")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, m)
+}
+
+func TestCommandsZRangeWithScores(t *testing.T) {
+	cmds, commands := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		return []interface{}{[]byte("a"), []byte("1.5"), []byte("b"), []byte("2")}, nil
+	})
+	zs, err := cmds.ZRangeWithScores(context.Background(), "key", 0, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []redisservice.Z{{"a", 1.5}, {"b", 2}}, zs)
+	assert.Equal(t, command{"ZRANGE", []interface{}{"key", int64(0), int64(-1), "WITHSCORES"}}, (*commands)[0])
+
+	_, err = cmds.ZAdd(context.Background(), "key", redisservice.Z{"c", 3})
+	assert.Equal(t, []interface{}{"key", float64(3), "c"}, (*commands)[1].args)
+}
+
+func TestCommandsScan(t *testing.T) {
+	pages := map[string][]interface{}{
+		"0": {[]byte("5"), []interface{}{[]byte("a"), []byte("b")}},
+		"5": {[]byte("7"), []interface{}{}},
+		"7": {[]byte("0"), []interface{}{[]byte("c")}},
+	}
+	cmds, commands := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		return pages[fmt.Sprint(args[1])], nil
+	})
+	it := cmds.SScan("set", "a*", 10)
+	var values []string
+	for it.Next(context.Background()) {
+		values = append(values, it.Val())
+	}
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []string{"a", "b", "c"}, values)
+	assert.Len(t, *commands, 3)
+	assert.Equal(t, command{"SSCAN", []interface{}{"set", int64(0), "MATCH", "a*", "COUNT", int64(10)}}, (*commands)[0])
+}
+
+func TestCommandsScanError(t *testing.T) {
+	cmds, _ := mockCommands(func(cmd string, args ...interface{}) (interface{}, error) {
+		return nil, redis.Error("ERR")
+	})
+	it := cmds.Scan("", 0)
+	assert.False(t, it.Next(context.Background()))
+	assert.Equal(t, redis.Error("ERR"), it.Err())
+}
@@ -0,0 +1,8 @@
+package redisservice
+
+var (
+	CommandKey = commandKey
+
+	ReleaseLockScript = releaseScript.src
+	RefreshLockScript = refreshScript.src
+)
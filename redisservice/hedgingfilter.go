@@ -0,0 +1,73 @@
+package redisservice
+
+import (
+	"context"
+	"strings"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/stats"
+)
+
+// readOnlyCommands can be hedged and served by replicas.
+var readOnlyCommands = map[string]bool{
+	"GET":       true,
+	"MGET":      true,
+	"STRLEN":    true,
+	"EXISTS":    true,
+	"HGET":      true,
+	"HMGET":     true,
+	"HGETALL":   true,
+	"LRANGE":    true,
+	"SMEMBERS":  true,
+	"SISMEMBER": true,
+	"ZRANGE":    true,
+	"ZSCORE":    true,
+}
+
+type clientAttempt struct {
+	original *ClientRequest
+	forked   *ClientRequest
+	ownsConn bool
+}
+
+func (a clientAttempt) Commit() {
+	a.original.Response = a.forked.Response
+	a.release()
+}
+
+func (a clientAttempt) Discard() {
+	a.release()
+}
+
+func (a clientAttempt) release() {
+	if a.ownsConn {
+		a.forked.conn.Close()
+	}
+}
+
+func forkClientRequest(ctx context.Context, n int) (context.Context, saola.Attempt) {
+	req := GetClientRequest(ctx)
+	if req == nil || req.pool == nil || req.requestType != Do || !readOnlyCommands[strings.ToUpper(req.Command)] {
+		return ctx, nil
+	}
+	forked := new(ClientRequest)
+	*forked = *req
+	forked.Response = nil
+	// The backup request can not share the connection with the primary one.
+	if n > 0 {
+		conn := req.pool.pool().Get()
+		if conn.Err() != nil {
+			// The pool is exhausted.
+			conn.Close()
+			return ctx, nil
+		}
+		forked.conn = &syncConn{pool: req.pool, Conn: conn}
+	}
+	return context.WithValue(ctx, requestKey{}, forked), clientAttempt{req, forked, n > 0}
+}
+
+// NewHedgingFilter sends a backup request on a separate connection for slow
+// read-only commands.
+func NewHedgingFilter(policy saola.HedgingPolicy, stats stats.StatsReceiver) saola.Filter {
+	return saola.NewHedgingFilter(policy, forkClientRequest, stats)
+}
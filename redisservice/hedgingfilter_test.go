@@ -0,0 +1,60 @@
+package redisservice_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/redisservice"
+	"github.com/arjantop/saola/stats/statstest"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedgingFilterGET(t *testing.T) {
+	var dials int32
+	r := statstest.NewRecorder()
+	pool := redisservice.Pool{
+		Filter: redisservice.NewHedgingFilter(saola.HedgingPolicy{Delay: 5 * time.Millisecond, Budget: 1}, r),
+		Dial: func() (redis.Conn, error) {
+			n := atomic.AddInt32(&dials, 1)
+			return &MockConn{
+				DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+					if n == 1 {
+						time.Sleep(100 * time.Millisecond)
+						return "slow", nil
+					}
+					return "fast", nil
+				},
+			}, nil
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	reply, err := conn.Do(context.Background(), "GET", "key")
+	assert.NoError(t, err)
+	assert.Equal(t, "fast", reply)
+	assert.Equal(t, int64(1), r.CounterValue("redis.hedge.won"))
+}
+
+func TestHedgingFilterWriteCommand(t *testing.T) {
+	r := statstest.NewRecorder()
+	pool := redisservice.Pool{
+		Filter: redisservice.NewHedgingFilter(saola.HedgingPolicy{Delay: time.Nanosecond, Budget: 1}, r),
+		Dial: func() (redis.Conn, error) {
+			return &MockConn{
+				DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+					time.Sleep(time.Millisecond)
+					return "OK", nil
+				},
+			}, nil
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do(context.Background(), "SET", "key", "value")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), r.CounterValue("redis.hedge.sent"), "write commands are never hedged")
+}
@@ -0,0 +1,260 @@
+package redisservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// ErrNotObtained is returned when the lock is held by someone else.
+	ErrNotObtained = errors.New("redis: lock not obtained")
+	// ErrLockNotHeld is returned when the lock expired or was obtained by
+	// someone else.
+	ErrLockNotHeld = errors.New("redis: lock not held")
+)
+
+var errInvalidTTL = errors.New("redis: lock ttl must be positive")
+
+// luaScript is executed with EVALSHA and sent with EVAL when the server does
+// not have it cached.
+type luaScript struct {
+	src string
+	sha string
+}
+
+func newLuaScript(src string) *luaScript {
+	h := sha1.Sum([]byte(src))
+	return &luaScript{src, hex.EncodeToString(h[:])}
+}
+
+func (s *luaScript) Do(ctx context.Context, c Client, keys []string, args ...interface{}) (interface{}, error) {
+	a := append(append([]interface{}{s.sha, len(keys)}, stringArgs(keys)...), args...)
+	r, err := c.Do(ctx, "EVALSHA", a...)
+	if e, ok := err.(redis.Error); ok && strings.HasPrefix(string(e), "NOSCRIPT") {
+		a[0] = s.src
+		return c.Do(ctx, "EVAL", a...)
+	}
+	return r, err
+}
+
+var (
+	releaseScript = newLuaScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+	refreshScript = newLuaScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+)
+
+// Lock is a lock of a key held until its TTL expires. The key is set to a
+// random token so that only the holder can release and refresh it.
+type Lock struct {
+	client  Client
+	key     string
+	token   string
+	ttl     time.Duration
+	expires time.Time
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Obtain obtains the lock of the key for the TTL, ErrNotObtained is returned
+// when it is held by someone else. The TTL has millisecond precision.
+func Obtain(ctx context.Context, c Client, key string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, errInvalidTTL
+	}
+	ttl = time.Duration(milliseconds(ttl)) * time.Millisecond
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	ok, err := NewCommands(c).SetNX(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotObtained
+	}
+	return &Lock{c, key, token, ttl, start.Add(ttl)}, nil
+}
+
+func (l *Lock) Key() string {
+	return l.key
+}
+
+func (l *Lock) Token() string {
+	return l.token
+}
+
+// Refresh extends the lock for another TTL.
+func (l *Lock) Refresh(ctx context.Context) error {
+	r, err := redis.Int(refreshScript.Do(ctx, l.client, []string{l.key}, l.token, milliseconds(l.ttl)))
+	if err != nil {
+		return err
+	}
+	if r == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Release releases the lock, ErrLockNotHeld is returned when it is not held
+// anymore.
+func (l *Lock) Release(ctx context.Context) error {
+	r, err := redis.Int(releaseScript.Do(ctx, l.client, []string{l.key}, l.token))
+	if err != nil {
+		return err
+	}
+	if r == 0 {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// Hold refreshes the lock every third of its TTL until the returned context is
+// cancelled. The context is cancelled with ErrLockNotHeld as the cause when
+// the lock is lost, either because it was obtained by someone else or because
+// it could not be refreshed before it expired.
+func (l *Lock) Hold(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	go func() {
+		expires := l.expires
+		t := time.NewTicker(l.ttl / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+			start := time.Now()
+			refreshCtx, cancelRefresh := context.WithDeadline(ctx, expires)
+			err := l.Refresh(refreshCtx)
+			cancelRefresh()
+			switch {
+			case err == nil:
+				expires = start.Add(l.ttl)
+			case ctx.Err() != nil:
+				return
+			case err == ErrLockNotHeld || !time.Now().Before(expires):
+				cancel(ErrLockNotHeld)
+				return
+			}
+		}
+	}()
+	return ctx, func() { cancel(context.Canceled) }
+}
+
+// WithLock runs f while holding the lock of the key, the context of f is
+// cancelled when the lock is lost. ErrNotObtained is returned when the lock
+// is held by someone else and ErrLockNotHeld when it was lost before f
+// returned without an error.
+func WithLock(ctx context.Context, c Client, key string, ttl time.Duration, f func(ctx context.Context) error) error {
+	l, err := Obtain(ctx, c, key, ttl)
+	if err != nil {
+		return err
+	}
+	lockCtx, cancel := l.Hold(ctx)
+	err = f(lockCtx)
+	lost := context.Cause(lockCtx) == ErrLockNotHeld
+	cancel()
+	if lost {
+		if err == nil {
+			err = ErrLockNotHeld
+		}
+		return err
+	}
+	if rerr := l.Release(context.WithoutCancel(ctx)); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Election elects a single leader among the processes campaigning for the
+// key.
+type Election struct {
+	// Client is usually a Pool.Client so that the leadership survives broken
+	// connections.
+	Client Client
+	Key    string
+	// TTL is the lease of the leadership, a new leader is elected at most TTL
+	// after the leader stops refreshing it. Defaults to 10s.
+	TTL time.Duration
+	// RetryInterval is the interval of the attempts to become the leader,
+	// defaults to a third of the TTL.
+	RetryInterval time.Duration
+
+	// OnElected is called when the leadership is gained with a context that
+	// is cancelled when it is lost.
+	OnElected func(ctx context.Context)
+	// OnLost is called when the leadership is lost or given up.
+	OnLost func()
+	// OnError is called with the errors of the attempts and of releasing the
+	// leadership.
+	OnError func(err error)
+
+	leader int32
+}
+
+// IsLeader reports whether the process is the leader.
+func (e *Election) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// Run campaigns for the leadership until the context is done, the leadership
+// is released when it is.
+func (e *Election) Run(ctx context.Context) error {
+	ttl := e.TTL
+	if ttl <= 0 {
+		ttl = 10 * time.Second
+	}
+	retry := e.RetryInterval
+	if retry <= 0 {
+		retry = ttl / 3
+	}
+	for {
+		l, err := Obtain(ctx, e.Client, e.Key, ttl)
+		if err == nil {
+			e.lead(ctx, l)
+		} else if err != ErrNotObtained && ctx.Err() == nil && e.OnError != nil {
+			e.OnError(err)
+		}
+		select {
+		case <-time.After(retry):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *Election) lead(ctx context.Context, l *Lock) {
+	leaderCtx, cancel := l.Hold(ctx)
+	defer cancel()
+	atomic.StoreInt32(&e.leader, 1)
+	if e.OnElected != nil {
+		e.OnElected(leaderCtx)
+	}
+	<-leaderCtx.Done()
+	atomic.StoreInt32(&e.leader, 0)
+	if ctx.Err() != nil {
+		err := l.Release(context.WithoutCancel(ctx))
+		if err != nil && err != ErrLockNotHeld && e.OnError != nil {
+			e.OnError(err)
+		}
+	}
+	if e.OnLost != nil {
+		e.OnLost()
+	}
+}
@@ -0,0 +1,211 @@
+package redisservice_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/arjantop/saola/redisservice/redistest"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLockServer returns a server emulating the lock scripts and a client
+// using it.
+func newLockServer() (*redistest.Server, redisservice.Client) {
+	s := redistest.NewServer()
+	ifToken := func(cmd ...string) redistest.ScriptFunc {
+		return func(call func(args ...string) interface{}, keys, args []string) interface{} {
+			if v, _ := call("GET", keys[0]).(string); v != args[0] {
+				return int64(0)
+			}
+			return call(append(append(cmd, keys[0]), args[1:]...)...)
+		}
+	}
+	s.Script(redisservice.ReleaseLockScript, ifToken("DEL"))
+	s.Script(redisservice.RefreshLockScript, ifToken("PEXPIRE"))
+	pool := &redisservice.Pool{Dial: s.Dial, MaxIdle: 2}
+	return s, pool.Client()
+}
+
+func TestLockObtainRelease(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	l, err := redisservice.Obtain(ctx, client, "lock", time.Minute)
+	assert.NoError(t, err)
+	_, err = redisservice.Obtain(ctx, client, "lock", time.Minute)
+	assert.Equal(t, redisservice.ErrNotObtained, err)
+
+	assert.NoError(t, l.Refresh(ctx))
+	assert.NoError(t, l.Release(ctx))
+	assert.Equal(t, redisservice.ErrLockNotHeld, l.Release(ctx))
+	assert.Equal(t, []string{"SET", "SET", "EVALSHA", "EVAL", "EVALSHA", "EVAL", "EVALSHA"}, s.CommandNames())
+
+	l, err = redisservice.Obtain(ctx, client, "lock", time.Minute)
+	assert.NoError(t, err)
+	assert.NoError(t, l.Release(ctx))
+}
+
+func TestLockShortTTL(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	_, err := redisservice.Obtain(ctx, client, "lock", 0)
+	assert.Error(t, err)
+	_, err = redisservice.Obtain(ctx, client, "lock", time.Microsecond)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PX", "1", "NX"}, s.Commands()[0][3:], "ttl should be rounded up to a millisecond")
+}
+
+func TestLockExpired(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	l, err := redisservice.Obtain(ctx, client, "lock", 10*time.Millisecond)
+	assert.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	other, err := redisservice.Obtain(ctx, client, "lock", time.Minute)
+	assert.NoError(t, err)
+	assert.Equal(t, redisservice.ErrLockNotHeld, l.Refresh(ctx))
+	assert.Equal(t, redisservice.ErrLockNotHeld, l.Release(ctx))
+	assert.NoError(t, other.Release(ctx))
+}
+
+func TestLockHold(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	l, err := redisservice.Obtain(ctx, client, "lock", 60*time.Millisecond)
+	assert.NoError(t, err)
+	holdCtx, cancel := l.Hold(ctx)
+	defer cancel()
+
+	time.Sleep(200 * time.Millisecond)
+	assert.NoError(t, holdCtx.Err(), "lock should be refreshed")
+	_, err = redisservice.Obtain(ctx, client, "lock", time.Minute)
+	assert.Equal(t, redisservice.ErrNotObtained, err)
+
+	redisservice.NewCommands(client).Del(ctx, "lock")
+	select {
+	case <-holdCtx.Done():
+		assert.Equal(t, redisservice.ErrLockNotHeld, context.Cause(holdCtx))
+	case <-time.After(time.Second):
+		t.Fatal("context should be cancelled when the lock is lost")
+	}
+}
+
+func TestLockHoldUnavailable(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	l, err := redisservice.Obtain(ctx, client, "lock", 60*time.Millisecond)
+	assert.NoError(t, err)
+	s.Inject(redistest.Fault{Err: "ERR unavailable"})
+	holdCtx, cancel := l.Hold(ctx)
+	defer cancel()
+	select {
+	case <-holdCtx.Done():
+		assert.Equal(t, redisservice.ErrLockNotHeld, context.Cause(holdCtx))
+	case <-time.After(time.Second):
+		t.Fatal("context should be cancelled when the lock expires")
+	}
+}
+
+func TestWithLock(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+	ctx := context.Background()
+
+	err := redisservice.WithLock(ctx, client, "lock", time.Minute, func(ctx context.Context) error {
+		return redisservice.WithLock(ctx, client, "lock", time.Minute, func(ctx context.Context) error {
+			t.Fatal("lock should be held")
+			return nil
+		})
+	})
+	assert.Equal(t, redisservice.ErrNotObtained, err)
+	n, _ := redisservice.NewCommands(client).Exists(ctx, "lock")
+	assert.Equal(t, int64(0), n, "lock should be released")
+}
+
+func TestElection(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+
+	var elected, lost int32
+	newElection := func() *redisservice.Election {
+		return &redisservice.Election{
+			Client:        client,
+			Key:           "leader",
+			TTL:           60 * time.Millisecond,
+			RetryInterval: 5 * time.Millisecond,
+			OnElected: func(ctx context.Context) {
+				atomic.AddInt32(&elected, 1)
+			},
+			OnLost: func() {
+				atomic.AddInt32(&lost, 1)
+			},
+		}
+	}
+	e1, e2 := newElection(), newElection()
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	done1 := make(chan error)
+	go func() { done1 <- e1.Run(ctx1) }()
+	waitFor(t, e1.IsLeader)
+	go e2.Run(ctx2)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.True(t, e1.IsLeader())
+	assert.False(t, e2.IsLeader())
+
+	cancel1()
+	assert.Equal(t, context.Canceled, <-done1)
+	assert.False(t, e1.IsLeader())
+	waitFor(t, e2.IsLeader)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&elected))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&lost))
+}
+
+func TestElectionReleaseError(t *testing.T) {
+	s, client := newLockServer()
+	defer s.Close()
+
+	errs := make(chan error, 1)
+	e := &redisservice.Election{
+		Client: client,
+		Key:    "leader",
+		TTL:    time.Minute,
+		OnError: func(err error) {
+			errs <- err
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- e.Run(ctx) }()
+	waitFor(t, e.IsLeader)
+
+	s.Inject(redistest.Fault{Command: "EVALSHA", Err: "ERR injected"})
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, redis.Error("ERR injected"), <-errs)
+}
+
+func waitFor(t *testing.T, f func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not satisfied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
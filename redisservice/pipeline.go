@@ -0,0 +1,167 @@
+package redisservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrTxAborted is returned when a transaction is not executed because a
+// watched key was modified.
+var ErrTxAborted = errors.New("redis: transaction aborted")
+
+// Cmd is a command of a pipeline or a transaction. Response and Err are set
+// when the batch is executed.
+type Cmd struct {
+	Command  string
+	Args     []interface{}
+	Response interface{}
+	Err      error
+}
+
+func NewCmd(cmd string, args ...interface{}) *Cmd {
+	return &Cmd{Command: cmd, Args: args}
+}
+
+// lockConn keeps the connection locked for the whole batch so that replies
+// are not interleaved with other requests.
+func lockConn(conn redis.Conn) (redis.Conn, func()) {
+	if sc, ok := conn.(*syncConn); ok {
+		sc.lock.Lock()
+		return sc.Conn, sc.lock.Unlock
+	}
+	return conn, func() {}
+}
+
+func isReplyError(err error) bool {
+	_, ok := err.(redis.Error)
+	return ok
+}
+
+func firstError(cmds []*Cmd) error {
+	for _, c := range cmds {
+		if c.Err != nil {
+			return c.Err
+		}
+	}
+	return nil
+}
+
+// failCommands sets the error on the commands that did not get a reply.
+func failCommands(cmds []*Cmd, err error) error {
+	for _, c := range cmds {
+		c.Response, c.Err = nil, err
+	}
+	return err
+}
+
+func doPipeline(ctx context.Context, req *ClientRequest) error {
+	conn, unlock := lockConn(req.conn)
+	defer unlock()
+	for _, c := range req.Commands {
+		if err := conn.Send(c.Command, c.Args...); err != nil {
+			return failCommands(req.Commands, err)
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return failCommands(req.Commands, err)
+	}
+	replies := make([]interface{}, len(req.Commands))
+	for i, c := range req.Commands {
+		c.Response, c.Err = receiveContext(ctx, conn)
+		if c.Err != nil && !isReplyError(c.Err) {
+			return failCommands(req.Commands[i:], c.Err)
+		}
+		replies[i] = c.Response
+	}
+	req.Response = replies
+	return firstError(req.Commands)
+}
+
+func doTransaction(ctx context.Context, req *ClientRequest) error {
+	conn, unlock := lockConn(req.conn)
+	defer unlock()
+	if err := conn.Send("MULTI"); err != nil {
+		return failCommands(req.Commands, err)
+	}
+	for _, c := range req.Commands {
+		if err := conn.Send(c.Command, c.Args...); err != nil {
+			return failCommands(req.Commands, err)
+		}
+	}
+	if err := conn.Send("EXEC"); err != nil {
+		return failCommands(req.Commands, err)
+	}
+	if err := conn.Flush(); err != nil {
+		return failCommands(req.Commands, err)
+	}
+	if _, err := receiveContext(ctx, conn); err != nil {
+		return failCommands(req.Commands, err)
+	}
+	// Commands rejected when queued abort the transaction.
+	for _, c := range req.Commands {
+		if _, err := receiveContext(ctx, conn); err != nil {
+			if !isReplyError(err) {
+				return failCommands(req.Commands, err)
+			}
+			c.Err = err
+		}
+	}
+	r, err := receiveContext(ctx, conn)
+	if err != nil {
+		if isReplyError(err) {
+			return err
+		}
+		return failCommands(req.Commands, err)
+	}
+	if r == nil {
+		return ErrTxAborted
+	}
+	replies, err := redis.Values(r, nil)
+	if err != nil {
+		return err
+	}
+	for i, c := range req.Commands {
+		if i >= len(replies) {
+			break
+		}
+		if e, ok := replies[i].(redis.Error); ok {
+			c.Err = e
+		} else {
+			c.Response = replies[i]
+		}
+	}
+	req.Response = replies
+	return firstError(req.Commands)
+}
+
+var errWatchNotSupported = errors.New("redis: Watch needs a connection from Pool.Get")
+
+// Watch executes the transaction returned by f with the keys watched. When a
+// watched key is modified before the transaction is executed f is retried at
+// most retries times, after that ErrTxAborted is returned. The keys are
+// watched on a single connection so c must be a connection from Pool.Get and
+// the values read in f must be read with it.
+func Watch(ctx context.Context, c Client, keys []string, retries int, f func(ctx context.Context) ([]*Cmd, error)) error {
+	if _, ok := c.(*connClient); !ok {
+		return errWatchNotSupported
+	}
+	for i := 0; ; i++ {
+		if _, err := c.Do(ctx, "WATCH", stringArgs(keys)...); err != nil {
+			return err
+		}
+		cmds, err := f(ctx)
+		if err != nil {
+			c.Do(ctx, "UNWATCH")
+			return err
+		}
+		err = c.Transaction(ctx, cmds...)
+		if err != ErrTxAborted || i >= retries {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package redisservice_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/redisservice"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// queueConn replies to the sent commands when they are received.
+func queueConn(reply func(cmd string, args ...interface{}) (interface{}, error)) (*MockConn, *[]string) {
+	var sent []string
+	var pending []command
+	conn := &MockConn{
+		DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+			sent = append(sent, cmd)
+			return reply(cmd, args...)
+		},
+		SendFunc: func(cmd string, args ...interface{}) error {
+			sent = append(sent, cmd)
+			pending = append(pending, command{cmd, args})
+			return nil
+		},
+		ReceiveFunc: func() (interface{}, error) {
+			c := pending[0]
+			pending = pending[1:]
+			return reply(c.name, c.args...)
+		},
+	}
+	return conn, &sent
+}
+
+func TestPipeline(t *testing.T) {
+	conn, sent := queueConn(func(cmd string, args ...interface{}) (interface{}, error) {
+		switch cmd {
+		case "INCR":
+			return int64(1), nil
+		case "GET":
+			return []byte("value"), nil
+		}
+		return nil, redis.Error("ERR unknown command")
+	})
+	var requests []*redisservice.ClientRequest
+	pool := redisservice.Pool{
+		Filter: saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+			requests = append(requests, redisservice.GetClientRequest(ctx))
+			return s.Do(ctx)
+		}),
+		Dial: func() (redis.Conn, error) {
+			return conn, nil
+		},
+	}
+	c := pool.Get()
+	incr := redisservice.NewCmd("INCR", "counter")
+	get := redisservice.NewCmd("GET", "key")
+	err := c.Pipeline(context.Background(), incr, get)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), incr.Response)
+	assert.Equal(t, []byte("value"), get.Response)
+	assert.Equal(t, []string{"INCR", "GET"}, *sent)
+
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "PIPELINE", requests[0].Command)
+	assert.Equal(t, []*redisservice.Cmd{incr, get}, requests[0].Commands)
+
+	unknown := redisservice.NewCmd("UNKNOWN")
+	err = c.Pipeline(context.Background(), unknown, redisservice.NewCmd("GET", "key"))
+	assert.Equal(t, redis.Error("ERR unknown command"), err)
+	assert.Equal(t, err, unknown.Err)
+}
+
+func TestPipelineConnError(t *testing.T) {
+	connErr := errors.New("connection reset")
+	conn, _ := queueConn(func(cmd string, args ...interface{}) (interface{}, error) {
+		if args[0] == "broken" {
+			return nil, connErr
+		}
+		return nil, nil
+	})
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return conn, nil
+		},
+	}
+	c := pool.Get()
+	missing := redisservice.NewCmd("GET", "missing")
+	broken := redisservice.NewCmd("GET", "broken")
+	unread := redisservice.NewCmd("GET", "unread")
+	err := c.Pipeline(context.Background(), missing, broken, unread)
+	assert.Equal(t, connErr, err)
+	assert.NoError(t, missing.Err, "nil reply was received")
+	assert.Equal(t, connErr, broken.Err)
+	assert.Equal(t, connErr, unread.Err)
+}
+
+func TestTransaction(t *testing.T) {
+	conn, sent := queueConn(func(cmd string, args ...interface{}) (interface{}, error) {
+		switch cmd {
+		case "MULTI":
+			return "OK", nil
+		case "EXEC":
+			return []interface{}{"OK", int64(2)}, nil
+		}
+		return "QUEUED", nil
+	})
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return conn, nil
+		},
+	}
+	set := redisservice.NewCmd("SET", "key", "value")
+	incr := redisservice.NewCmd("INCR", "counter")
+	err := pool.Get().Transaction(context.Background(), set, incr)
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", set.Response)
+	assert.Equal(t, int64(2), incr.Response)
+	assert.Equal(t, []string{"MULTI", "SET", "INCR", "EXEC"}, *sent)
+}
+
+func TestTransactionConnError(t *testing.T) {
+	connErr := errors.New("connection reset")
+	conn, _ := queueConn(func(cmd string, args ...interface{}) (interface{}, error) {
+		if cmd == "EXEC" {
+			return nil, connErr
+		}
+		return "QUEUED", nil
+	})
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return conn, nil
+		},
+	}
+	set := redisservice.NewCmd("SET", "key", "value")
+	incr := redisservice.NewCmd("INCR", "counter")
+	err := pool.Get().Transaction(context.Background(), set, incr)
+	assert.Equal(t, connErr, err)
+	assert.Equal(t, connErr, set.Err)
+	assert.Equal(t, connErr, incr.Err)
+}
+
+func TestWatchPooledClient(t *testing.T) {
+	var sent []string
+	pool := &redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return &MockConn{DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+				sent = append(sent, cmd)
+				return "OK", nil
+			}}, nil
+		},
+	}
+	err := redisservice.Watch(context.Background(), pool.Client(), []string{"key"}, 0, func(ctx context.Context) ([]*redisservice.Cmd, error) {
+		return nil, nil
+	})
+	assert.Error(t, err, "keys can not be watched across pooled connections")
+	assert.Empty(t, sent)
+}
+
+func TestWatchRetry(t *testing.T) {
+	var execs int
+	conn, sent := queueConn(func(cmd string, args ...interface{}) (interface{}, error) {
+		switch cmd {
+		case "EXEC":
+			execs++
+			if execs == 1 {
+				return nil, nil
+			}
+			return []interface{}{"OK"}, nil
+		case "GET":
+			return []byte("1"), nil
+		}
+		return "OK", nil
+	})
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			return conn, nil
+		},
+	}
+	c := pool.Get()
+	err := redisservice.Watch(context.Background(), c, []string{"key"}, 1, func(ctx context.Context) ([]*redisservice.Cmd, error) {
+		v, err := redis.Int(c.Do(ctx, "GET", "key"))
+		if err != nil {
+			return nil, err
+		}
+		return []*redisservice.Cmd{redisservice.NewCmd("SET", "key", v+1)}, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"WATCH", "GET", "MULTI", "SET", "EXEC",
+		"WATCH", "GET", "MULTI", "SET", "EXEC",
+	}, *sent)
+
+	execs = 0
+	err = redisservice.Watch(context.Background(), c, []string{"key"}, 0, func(ctx context.Context) ([]*redisservice.Cmd, error) {
+		return nil, nil
+	})
+	assert.Equal(t, redisservice.ErrTxAborted, err)
+}
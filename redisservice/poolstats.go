@@ -0,0 +1,74 @@
+package redisservice
+
+import (
+	"time"
+
+	"github.com/arjantop/saola/stats"
+	"github.com/garyburd/redigo/redis"
+)
+
+// dial wraps Pool.Dial to count the dials and to record the lifetime of the
+// connections.
+func (p *Pool) dial() func() (redis.Conn, error) {
+	if p.Stats == nil || p.Dial == nil {
+		return p.Dial
+	}
+	return func() (redis.Conn, error) {
+		poolStats := p.poolStats()
+		conn, err := p.Dial()
+		if err != nil {
+			poolStats.Counter("dial_failures").Incr()
+			return nil, err
+		}
+		poolStats.Counter("dials").Incr()
+		return &lifetimeConn{Conn: conn, created: time.Now(), stats: poolStats}, nil
+	}
+}
+
+func (p *Pool) testOnBorrow() func(redis.Conn, time.Time) error {
+	if p.Stats == nil || p.TestOnBorrow == nil {
+		return p.TestOnBorrow
+	}
+	return func(c redis.Conn, t time.Time) error {
+		err := p.TestOnBorrow(c, t)
+		if err != nil {
+			p.poolStats().Counter("test_on_borrow_failures").Incr()
+		}
+		return err
+	}
+}
+
+func (p *Pool) updateGauges() {
+	if p.Stats == nil {
+		return
+	}
+	p.lock.Lock()
+	impl := p.implPool
+	p.lock.Unlock()
+	if impl == nil {
+		return
+	}
+	s := impl.Stats()
+	poolStats := p.poolStats()
+	poolStats.Gauge("active").Set(float64(s.ActiveCount))
+	poolStats.Gauge("idle").Set(float64(s.IdleCount))
+}
+
+type lifetimeConn struct {
+	redis.Conn
+	created time.Time
+	stats   stats.StatsReceiver
+}
+
+func (c *lifetimeConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *lifetimeConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+func (c *lifetimeConn) Close() error {
+	c.stats.Timer("connection_lifetime").Add(time.Now().Sub(c.created))
+	return c.Conn.Close()
+}
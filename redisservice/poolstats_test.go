@@ -0,0 +1,53 @@
+package redisservice_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/arjantop/saola/stats/statstest"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolStats(t *testing.T) {
+	r := statstest.NewRecorder()
+	failDial := false
+	pool := redisservice.Pool{
+		Dial: func() (redis.Conn, error) {
+			if failDial {
+				return nil, errors.New("dial")
+			}
+			return &MockConn{}, nil
+		},
+		TestOnBorrow: func(c redis.Conn, t time.Time) error {
+			return errors.New("broken")
+		},
+		MaxIdle: 1,
+		Stats:   r,
+	}
+
+	c1 := pool.Get()
+	c2 := pool.Get()
+	assert.Equal(t, int64(2), r.CounterValue("redis.pool.dials"))
+	assert.Equal(t, float64(2), r.GaugeValue("redis.pool.active"))
+	assert.Equal(t, float64(0), r.GaugeValue("redis.pool.idle"))
+
+	c1.Do(context.Background(), "GET", "key")
+	assert.Equal(t, int64(1), r.CounterValue("redis.command.GET.requests"))
+
+	c1.Close()
+	c2.Close()
+	assert.Equal(t, float64(1), r.GaugeValue("redis.pool.active"))
+	assert.Equal(t, float64(1), r.GaugeValue("redis.pool.idle"))
+	assert.True(t, r.TimerValue("redis.pool.connection_lifetime") > 0)
+
+	// The idle connection fails the test and the new one can not be dialed.
+	failDial = true
+	c3 := pool.Get()
+	assert.Error(t, c3.Send(context.Background(), "GET", "key"))
+	assert.Equal(t, int64(1), r.CounterValue("redis.pool.test_on_borrow_failures"))
+	assert.Equal(t, int64(1), r.CounterValue("redis.pool.dial_failures"))
+}
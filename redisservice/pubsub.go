@@ -0,0 +1,163 @@
+package redisservice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/garyburd/redigo/redis"
+)
+
+// Message is a message received by a Subscriber.
+type Message struct {
+	Channel string
+	// Pattern is the matched pattern of messages received with PSUBSCRIBE.
+	Pattern string
+	Data    []byte
+}
+
+type messageKey struct{}
+
+func WithMessage(ctx context.Context, m *Message) context.Context {
+	return context.WithValue(ctx, messageKey{}, m)
+}
+
+func GetMessage(ctx context.Context) *Message {
+	m, _ := ctx.Value(messageKey{}).(*Message)
+	return m
+}
+
+// ChannelHandler is a Subscriber handler that sends the messages to the
+// channel.
+func ChannelHandler(ch chan<- Message) saola.Service {
+	return saola.FuncService(func(ctx context.Context) error {
+		select {
+		case ch <- *GetMessage(ctx):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+var errHealthCheck = errors.New("redis: pubsub health check timed out")
+
+// Subscriber subscribes to the channels and patterns on a dedicated connection
+// and calls the handler with each message in the context (see GetMessage).
+// The subscriptions are restored when the connection is lost.
+type Subscriber struct {
+	Pool     *Pool
+	Channels []string
+	Patterns []string
+	Handler  saola.Service
+
+	// MinBackoff and MaxBackoff bound the exponential backoff between the
+	// reconnects, they default to 100ms and 10s.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// HealthCheck is the interval of pings used to detect broken connections,
+	// disabled when 0.
+	HealthCheck time.Duration
+
+	// OnError is called with the errors of the connection.
+	OnError func(err error)
+}
+
+// Run receives the messages until the context is done.
+func (s *Subscriber) Run(ctx context.Context) error {
+	minBackoff := s.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = 100 * time.Millisecond
+	}
+	maxBackoff := s.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 10 * time.Second
+	}
+	backoff := minBackoff
+	for {
+		err := s.receive(ctx, func() {
+			backoff = minBackoff
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.OnError != nil {
+			s.OnError(err)
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func (s *Subscriber) receive(ctx context.Context, subscribed func()) error {
+	conn, err := s.Pool.Dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Closing the connection unblocks Receive on shutdown.
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	psc := redis.PubSubConn{Conn: conn}
+	if len(s.Channels) > 0 {
+		if err := psc.Subscribe(redis.Args{}.AddFlat(s.Channels)...); err != nil {
+			return err
+		}
+	}
+	if len(s.Patterns) > 0 {
+		if err := psc.PSubscribe(redis.Args{}.AddFlat(s.Patterns)...); err != nil {
+			return err
+		}
+	}
+
+	receive := psc.Receive
+	if s.HealthCheck > 0 {
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			t := time.NewTicker(s.HealthCheck)
+			defer t.Stop()
+			for {
+				select {
+				case <-t.C:
+					if psc.Ping("") != nil {
+						return
+					}
+				case <-done:
+					return
+				}
+			}
+		}()
+		receive = func() interface{} {
+			return psc.ReceiveWithTimeout(2 * s.HealthCheck)
+		}
+	}
+
+	for {
+		switch v := receive().(type) {
+		case redis.Message:
+			s.Handler.Do(WithMessage(ctx, &Message{Channel: v.Channel, Data: v.Data}))
+		case redis.PMessage:
+			s.Handler.Do(WithMessage(ctx, &Message{Channel: v.Channel, Pattern: v.Pattern, Data: v.Data}))
+		case redis.Subscription:
+			subscribed()
+		case error:
+			if e, ok := v.(interface{ Timeout() bool }); ok && e.Timeout() {
+				return errHealthCheck
+			}
+			return v
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package redisservice_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+type subscriberConn struct {
+	MockConn
+	replies chan interface{}
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newSubscriberConn(subscribed chan<- []interface{}) *subscriberConn {
+	c := &subscriberConn{
+		replies: make(chan interface{}, 10),
+		closed:  make(chan struct{}),
+	}
+	c.SendFunc = func(cmd string, args ...interface{}) error {
+		subscribed <- append([]interface{}{cmd}, args...)
+		for _, ch := range args {
+			c.replies <- []interface{}{[]byte(strings.ToLower(cmd)), []byte(ch.(string)), int64(1)}
+		}
+		return nil
+	}
+	c.ReceiveFunc = func() (interface{}, error) {
+		select {
+		case r, ok := <-c.replies:
+			if !ok {
+				return nil, io.EOF
+			}
+			return r, nil
+		case <-c.closed:
+			return nil, io.EOF
+		}
+	}
+	c.CloseFunc = func() error {
+		c.once.Do(func() { close(c.closed) })
+		return nil
+	}
+	return c
+}
+
+func TestSubscriber(t *testing.T) {
+	subscribed := make(chan []interface{}, 10)
+	conns := make(chan *subscriberConn, 10)
+	messages := make(chan redisservice.Message)
+	s := &redisservice.Subscriber{
+		Pool: &redisservice.Pool{
+			Dial: func() (redis.Conn, error) {
+				c := newSubscriberConn(subscribed)
+				conns <- c
+				return c, nil
+			},
+		},
+		Channels:   []string{"invalidate"},
+		Patterns:   []string{"user.*"},
+		Handler:    redisservice.ChannelHandler(messages),
+		MinBackoff: time.Millisecond,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+
+	conn := <-conns
+	assert.Equal(t, []interface{}{"SUBSCRIBE", "invalidate"}, <-subscribed)
+	assert.Equal(t, []interface{}{"PSUBSCRIBE", "user.*"}, <-subscribed)
+	conn.replies <- []interface{}{[]byte("message"), []byte("invalidate"), []byte("key")}
+	assert.Equal(t, redisservice.Message{Channel: "invalidate", Data: []byte("key")}, <-messages)
+
+	// The subscriptions are restored after the connection is lost.
+	close(conn.replies)
+	conn = <-conns
+	assert.Equal(t, []interface{}{"SUBSCRIBE", "invalidate"}, <-subscribed)
+	assert.Equal(t, []interface{}{"PSUBSCRIBE", "user.*"}, <-subscribed)
+	conn.replies <- []interface{}{[]byte("pmessage"), []byte("user.*"), []byte("user.1"), []byte("x")}
+	assert.Equal(t, redisservice.Message{Channel: "user.1", Pattern: "user.*", Data: []byte("x")}, <-messages)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("subscriber should stop when the context is cancelled")
+	}
+}
@@ -0,0 +1,870 @@
+package redistest
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	errWrongType = respError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errNotInt    = respError("ERR value is not an integer or out of range")
+	errSyntax    = respError("ERR syntax error")
+)
+
+type command struct {
+	// minArgs and maxArgs bound the number of arguments, maxArgs is
+	// unbounded when -1.
+	minArgs, maxArgs int
+	// tx commands control the transaction and are not queued.
+	tx bool
+	f  func(s *Server, c *conn, args []string) interface{}
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":     {0, 1, false, ping},
+		"ECHO":     {1, 1, false, echo},
+		"SELECT":   {1, 1, false, reply("OK")},
+		"AUTH":     {1, 2, false, reply("OK")},
+		"QUIT":     {0, 0, false, reply("OK")},
+		"FLUSHDB":  {0, 1, false, flushAll},
+		"FLUSHALL": {0, 1, false, flushAll},
+		"DBSIZE":   {0, 0, false, dbSize},
+
+		"MULTI":   {0, 0, true, multi},
+		"EXEC":    {0, 0, true, exec},
+		"DISCARD": {0, 0, true, discard},
+		"WATCH":   {1, -1, true, watch},
+		"UNWATCH": {0, 0, false, unwatch},
+
+		"GET":    {1, 1, false, get},
+		"SET":    {2, -1, false, set},
+		"SETNX":  {2, 2, false, setNX},
+		"SETEX":  {3, 3, false, setEX},
+		"GETSET": {2, 2, false, getSet},
+		"MGET":   {1, -1, false, mget},
+		"MSET":   {2, -1, false, mset},
+		"INCR":   {1, 1, false, incrBy(1)},
+		"DECR":   {1, 1, false, incrBy(-1)},
+		"INCRBY": {2, 2, false, incrBy(1)},
+		"DECRBY": {2, 2, false, incrBy(-1)},
+		"APPEND": {2, 2, false, appendString},
+		"STRLEN": {1, 1, false, strlen},
+
+		"DEL":     {1, -1, false, del},
+		"EXISTS":  {1, -1, false, exists},
+		"TYPE":    {1, 1, false, typeOf},
+		"KEYS":    {1, 1, false, keys},
+		"EXPIRE":  {2, 2, false, expire(time.Second)},
+		"PEXPIRE": {2, 2, false, expire(time.Millisecond)},
+		"TTL":     {1, 1, false, ttl(time.Second)},
+		"PTTL":    {1, 1, false, ttl(time.Millisecond)},
+		"PERSIST": {1, 1, false, persist},
+
+		"EVAL":    {2, -1, false, eval(true)},
+		"EVALSHA": {2, -1, false, eval(false)},
+		"SCRIPT":  {1, -1, false, script},
+
+		"HSET":    {3, -1, false, hset},
+		"HMSET":   {3, -1, false, hmset},
+		"HGET":    {2, 2, false, hget},
+		"HMGET":   {2, -1, false, hmget},
+		"HGETALL": {1, 1, false, hgetAll},
+		"HDEL":    {2, -1, false, hdel},
+		"HEXISTS": {2, 2, false, hexists},
+		"HINCRBY": {3, 3, false, hincrBy},
+		"HLEN":    {1, 1, false, hlen},
+		"HKEYS":   {1, 1, false, hkeys},
+		"HVALS":   {1, 1, false, hvals},
+
+		"LPUSH":  {2, -1, false, push(true)},
+		"RPUSH":  {2, -1, false, push(false)},
+		"LPOP":   {1, 1, false, pop(true)},
+		"RPOP":   {1, 1, false, pop(false)},
+		"LRANGE": {3, 3, false, lrange},
+		"LLEN":   {1, 1, false, llen},
+		"LINDEX": {2, 2, false, lindex},
+		"LTRIM":  {3, 3, false, ltrim},
+	}
+}
+
+func (c *conn) handle(args []string) interface{} {
+	name := strings.ToUpper(args[0])
+	cmd, ok := commands[name]
+	if !ok {
+		c.aborted = c.multi
+		return respError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	if n := len(args) - 1; n < cmd.minArgs || (cmd.maxArgs >= 0 && n > cmd.maxArgs) {
+		c.aborted = c.multi
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	}
+	if c.multi && !cmd.tx {
+		c.queued = append(c.queued, args)
+		return status("QUEUED")
+	}
+	c.server.lock.Lock()
+	defer c.server.lock.Unlock()
+	return cmd.f(c.server, c, args[1:])
+}
+
+// lookup returns the entry of the key, removing it when expired.
+func (s *Server) lookup(key string) *entry {
+	e, ok := s.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(s.data, key)
+		s.touch(key)
+		return nil
+	}
+	return e
+}
+
+// touch marks the key as modified for the transactions watching it.
+func (s *Server) touch(key string) {
+	s.versions[key]++
+}
+
+func (s *Server) flush() {
+	for key := range s.data {
+		s.touch(key)
+	}
+	s.data = make(map[string]*entry)
+}
+
+func (s *Server) setValue(key string, value interface{}) {
+	s.data[key] = &entry{value: value}
+	s.touch(key)
+}
+
+func (s *Server) str(key string) (string, bool, interface{}) {
+	e := s.lookup(key)
+	if e == nil {
+		return "", false, nil
+	}
+	v, ok := e.value.(string)
+	if !ok {
+		return "", false, errWrongType
+	}
+	return v, true, nil
+}
+
+// hash returns the hash of the key, creating it when create is set.
+func (s *Server) hash(key string, create bool) (map[string]string, interface{}) {
+	e := s.lookup(key)
+	if e == nil {
+		if !create {
+			return nil, nil
+		}
+		h := make(map[string]string)
+		s.data[key] = &entry{value: h}
+		return h, nil
+	}
+	h, ok := e.value.(map[string]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return h, nil
+}
+
+func (s *Server) list(key string) ([]string, interface{}) {
+	e := s.lookup(key)
+	if e == nil {
+		return nil, nil
+	}
+	l, ok := e.value.([]string)
+	if !ok {
+		return nil, errWrongType
+	}
+	return l, nil
+}
+
+// setList stores the list, removing the key when it is empty.
+func (s *Server) setList(key string, l []string) {
+	if len(l) == 0 {
+		delete(s.data, key)
+		s.touch(key)
+		return
+	}
+	if e := s.lookup(key); e != nil {
+		e.value = l
+	} else {
+		s.data[key] = &entry{value: l}
+	}
+	s.touch(key)
+}
+
+func reply(r status) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		return r
+	}
+}
+
+func ping(s *Server, c *conn, args []string) interface{} {
+	if len(args) == 1 {
+		return args[0]
+	}
+	return status("PONG")
+}
+
+func echo(s *Server, c *conn, args []string) interface{} {
+	return args[0]
+}
+
+func flushAll(s *Server, c *conn, args []string) interface{} {
+	s.flush()
+	return status("OK")
+}
+
+func dbSize(s *Server, c *conn, args []string) interface{} {
+	var n int64
+	for key := range s.data {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func multi(s *Server, c *conn, args []string) interface{} {
+	if c.multi {
+		return respError("ERR MULTI calls can not be nested")
+	}
+	c.multi = true
+	return status("OK")
+}
+
+func (c *conn) resetTx() {
+	c.multi = false
+	c.queued = nil
+	c.aborted = false
+	c.watched = nil
+}
+
+func exec(s *Server, c *conn, args []string) interface{} {
+	if !c.multi {
+		return respError("ERR EXEC without MULTI")
+	}
+	defer c.resetTx()
+	if c.aborted {
+		return respError("EXECABORT Transaction discarded because of previous errors.")
+	}
+	for key, version := range c.watched {
+		if s.versions[key] != version {
+			return []interface{}(nil)
+		}
+	}
+	replies := make([]interface{}, len(c.queued))
+	for i, args := range c.queued {
+		replies[i] = commands[strings.ToUpper(args[0])].f(s, c, args[1:])
+	}
+	return replies
+}
+
+func discard(s *Server, c *conn, args []string) interface{} {
+	if !c.multi {
+		return respError("ERR DISCARD without MULTI")
+	}
+	c.resetTx()
+	return status("OK")
+}
+
+func watch(s *Server, c *conn, args []string) interface{} {
+	if c.multi {
+		return respError("ERR WATCH inside MULTI is not allowed")
+	}
+	if c.watched == nil {
+		c.watched = make(map[string]uint64)
+	}
+	for _, key := range args {
+		s.lookup(key)
+		if _, ok := c.watched[key]; !ok {
+			c.watched[key] = s.versions[key]
+		}
+	}
+	return status("OK")
+}
+
+func unwatch(s *Server, c *conn, args []string) interface{} {
+	c.watched = nil
+	return status("OK")
+}
+
+func get(s *Server, c *conn, args []string) interface{} {
+	v, found, err := s.str(args[0])
+	if err != nil || !found {
+		return err
+	}
+	return v
+}
+
+func set(s *Server, c *conn, args []string) interface{} {
+	key, value := args[0], args[1]
+	var expires time.Time
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				return respError("ERR invalid expire time in 'set' command")
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expires = time.Now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	exists := s.lookup(key) != nil
+	if (nx && exists) || (xx && !exists) {
+		return nil
+	}
+	s.setValue(key, value)
+	s.data[key].expires = expires
+	return status("OK")
+}
+
+func setNX(s *Server, c *conn, args []string) interface{} {
+	if s.lookup(args[0]) != nil {
+		return int64(0)
+	}
+	s.setValue(args[0], args[1])
+	return int64(1)
+}
+
+func setEX(s *Server, c *conn, args []string) interface{} {
+	n, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil || n <= 0 {
+		return respError("ERR invalid expire time in 'setex' command")
+	}
+	s.setValue(args[0], args[2])
+	s.data[args[0]].expires = time.Now().Add(time.Duration(n) * time.Second)
+	return status("OK")
+}
+
+func getSet(s *Server, c *conn, args []string) interface{} {
+	old := get(s, c, args[:1])
+	if _, isErr := old.(respError); isErr {
+		return old
+	}
+	s.setValue(args[0], args[1])
+	return old
+}
+
+func mget(s *Server, c *conn, args []string) interface{} {
+	values := make([]interface{}, len(args))
+	for i, key := range args {
+		if v, found, _ := s.str(key); found {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func mset(s *Server, c *conn, args []string) interface{} {
+	if len(args)%2 != 0 {
+		return respError("ERR wrong number of arguments for 'mset' command")
+	}
+	for i := 0; i < len(args); i += 2 {
+		s.setValue(args[i], args[i+1])
+	}
+	return status("OK")
+}
+
+func incrBy(sign int64) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		by := int64(1)
+		if len(args) > 1 {
+			var err error
+			if by, err = strconv.ParseInt(args[1], 10, 64); err != nil {
+				return errNotInt
+			}
+		}
+		v, found, err := s.str(args[0])
+		if err != nil {
+			return err
+		}
+		var n int64
+		if found {
+			var err error
+			if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return errNotInt
+			}
+		}
+		n += sign * by
+		if e := s.lookup(args[0]); e != nil {
+			e.value = strconv.FormatInt(n, 10)
+			s.touch(args[0])
+		} else {
+			s.setValue(args[0], strconv.FormatInt(n, 10))
+		}
+		return n
+	}
+}
+
+func appendString(s *Server, c *conn, args []string) interface{} {
+	v, _, err := s.str(args[0])
+	if err != nil {
+		return err
+	}
+	v += args[1]
+	if e := s.lookup(args[0]); e != nil {
+		e.value = v
+		s.touch(args[0])
+	} else {
+		s.setValue(args[0], v)
+	}
+	return int64(len(v))
+}
+
+func strlen(s *Server, c *conn, args []string) interface{} {
+	v, _, err := s.str(args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(v))
+}
+
+func del(s *Server, c *conn, args []string) interface{} {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			delete(s.data, key)
+			s.touch(key)
+			n++
+		}
+	}
+	return n
+}
+
+func exists(s *Server, c *conn, args []string) interface{} {
+	var n int64
+	for _, key := range args {
+		if s.lookup(key) != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func typeOf(s *Server, c *conn, args []string) interface{} {
+	e := s.lookup(args[0])
+	if e == nil {
+		return status("none")
+	}
+	switch e.value.(type) {
+	case map[string]string:
+		return status("hash")
+	case []string:
+		return status("list")
+	}
+	return status("string")
+}
+
+func keys(s *Server, c *conn, args []string) interface{} {
+	matched := []string{}
+	for key := range s.data {
+		if ok, _ := path.Match(args[0], key); ok && s.lookup(key) != nil {
+			matched = append(matched, key)
+		}
+	}
+	sort.Strings(matched)
+	return matched
+}
+
+func expire(unit time.Duration) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		n, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return errNotInt
+		}
+		e := s.lookup(args[0])
+		if e == nil {
+			return int64(0)
+		}
+		e.expires = time.Now().Add(time.Duration(n) * unit)
+		s.touch(args[0])
+		s.lookup(args[0])
+		return int64(1)
+	}
+}
+
+func ttl(unit time.Duration) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		e := s.lookup(args[0])
+		if e == nil {
+			return int64(-2)
+		}
+		if e.expires.IsZero() {
+			return int64(-1)
+		}
+		return int64((time.Until(e.expires) + unit/2) / unit)
+	}
+}
+
+func persist(s *Server, c *conn, args []string) interface{} {
+	e := s.lookup(args[0])
+	if e == nil || e.expires.IsZero() {
+		return int64(0)
+	}
+	e.expires = time.Time{}
+	s.touch(args[0])
+	return int64(1)
+}
+
+func eval(source bool) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		sha := args[0]
+		if source {
+			sha = scriptSHA(args[0])
+			s.loaded[sha] = true
+		}
+		sha = strings.ToLower(sha)
+		f, ok := s.scripts[sha]
+		if !ok && source {
+			return respError("ERR redistest: script is not registered")
+		} else if !ok || !s.loaded[sha] {
+			return respError("NOSCRIPT No matching script. Please use EVAL.")
+		}
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 0 || n > len(args)-2 {
+			return respError("ERR Number of keys can't be greater than number of args")
+		}
+		call := func(args ...string) interface{} {
+			cmd, ok := commands[strings.ToUpper(args[0])]
+			if !ok || cmd.tx {
+				return errors.New("ERR unknown command called from script")
+			}
+			r := cmd.f(s, c, args[1:])
+			switch r := r.(type) {
+			case respError:
+				return errors.New(string(r))
+			case status:
+				return string(r)
+			}
+			return r
+		}
+		switch r := f(call, args[2:2+n], args[2+n:]).(type) {
+		case error:
+			return respError(r.Error())
+		case nil, int64, string, []string, []interface{}:
+			return r
+		default:
+			return respError(fmt.Sprintf("ERR redistest: unexpected script reply %T", r))
+		}
+	}
+}
+
+func script(s *Server, c *conn, args []string) interface{} {
+	switch strings.ToUpper(args[0]) {
+	case "LOAD":
+		if len(args) != 2 {
+			return errSyntax
+		}
+		sha := scriptSHA(args[1])
+		if _, ok := s.scripts[sha]; !ok {
+			return respError("ERR redistest: script is not registered")
+		}
+		s.loaded[sha] = true
+		return sha
+	case "EXISTS":
+		r := make([]interface{}, len(args)-1)
+		for i, sha := range args[1:] {
+			r[i] = int64(0)
+			if s.loaded[strings.ToLower(sha)] {
+				r[i] = int64(1)
+			}
+		}
+		return r
+	}
+	return errSyntax
+}
+
+func hset(s *Server, c *conn, args []string) interface{} {
+	if len(args)%2 != 1 {
+		return respError("ERR wrong number of arguments for 'hset' command")
+	}
+	h, err := s.hash(args[0], true)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for i := 1; i < len(args); i += 2 {
+		if _, ok := h[args[i]]; !ok {
+			n++
+		}
+		h[args[i]] = args[i+1]
+	}
+	s.touch(args[0])
+	return n
+}
+
+func hmset(s *Server, c *conn, args []string) interface{} {
+	r := hset(s, c, args)
+	if _, isErr := r.(respError); isErr {
+		return r
+	}
+	return status("OK")
+}
+
+func hget(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	if v, ok := h[args[1]]; ok {
+		return v
+	}
+	return nil
+}
+
+func hmget(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(args)-1)
+	for i, field := range args[1:] {
+		if v, ok := h[field]; ok {
+			values[i] = v
+		}
+	}
+	return values
+}
+
+func sortedFields(h map[string]string) []string {
+	fields := make([]string, 0, len(h))
+	for f := range h {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func hgetAll(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	values := []string{}
+	for _, f := range sortedFields(h) {
+		values = append(values, f, h[f])
+	}
+	return values
+}
+
+func hdel(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	var n int64
+	for _, field := range args[1:] {
+		if _, ok := h[field]; ok {
+			delete(h, field)
+			n++
+		}
+	}
+	if n > 0 {
+		if len(h) == 0 {
+			delete(s.data, args[0])
+		}
+		s.touch(args[0])
+	}
+	return n
+}
+
+func hexists(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	if _, ok := h[args[1]]; ok {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func hincrBy(s *Server, c *conn, args []string) interface{} {
+	by, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return errNotInt
+	}
+	h, herr := s.hash(args[0], true)
+	if herr != nil {
+		return herr
+	}
+	var n int64
+	if v, ok := h[args[1]]; ok {
+		if n, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return respError("ERR hash value is not an integer")
+		}
+	}
+	n += by
+	h[args[1]] = strconv.FormatInt(n, 10)
+	s.touch(args[0])
+	return n
+}
+
+func hlen(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	return int64(len(h))
+}
+
+func hkeys(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	return sortedFields(h)
+}
+
+func hvals(s *Server, c *conn, args []string) interface{} {
+	h, err := s.hash(args[0], false)
+	if err != nil {
+		return err
+	}
+	values := []string{}
+	for _, f := range sortedFields(h) {
+		values = append(values, h[f])
+	}
+	return values
+}
+
+func push(left bool) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		l, err := s.list(args[0])
+		if err != nil {
+			return err
+		}
+		for _, v := range args[1:] {
+			if left {
+				l = append([]string{v}, l...)
+			} else {
+				l = append(l, v)
+			}
+		}
+		s.setList(args[0], l)
+		return int64(len(l))
+	}
+}
+
+func pop(left bool) func(s *Server, c *conn, args []string) interface{} {
+	return func(s *Server, c *conn, args []string) interface{} {
+		l, err := s.list(args[0])
+		if err != nil || len(l) == 0 {
+			return err
+		}
+		var v string
+		if left {
+			v, l = l[0], l[1:]
+		} else {
+			v, l = l[len(l)-1], l[:len(l)-1]
+		}
+		s.setList(args[0], l)
+		return v
+	}
+}
+
+// listRange converts the inclusive start and stop indexes, negative from the
+// end, to a slice range.
+func listRange(length int, start, stop string) (int, int, interface{}) {
+	i, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, 0, errNotInt
+	}
+	j, err := strconv.Atoi(stop)
+	if err != nil {
+		return 0, 0, errNotInt
+	}
+	if i < 0 {
+		i += length
+	}
+	if j < 0 {
+		j += length
+	}
+	if i < 0 {
+		i = 0
+	}
+	if j >= length {
+		j = length - 1
+	}
+	if i > j {
+		return 0, 0, nil
+	}
+	return i, j + 1, nil
+}
+
+func lrange(s *Server, c *conn, args []string) interface{} {
+	l, err := s.list(args[0])
+	if err != nil {
+		return err
+	}
+	i, j, err := listRange(len(l), args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return append([]string{}, l[i:j]...)
+}
+
+func llen(s *Server, c *conn, args []string) interface{} {
+	l, err := s.list(args[0])
+	if err != nil {
+		return err
+	}
+	return int64(len(l))
+}
+
+func lindex(s *Server, c *conn, args []string) interface{} {
+	l, err := s.list(args[0])
+	if err != nil {
+		return err
+	}
+	i, perr := strconv.Atoi(args[1])
+	if perr != nil {
+		return errNotInt
+	}
+	if i < 0 {
+		i += len(l)
+	}
+	if i < 0 || i >= len(l) {
+		return nil
+	}
+	return l[i]
+}
+
+func ltrim(s *Server, c *conn, args []string) interface{} {
+	l, err := s.list(args[0])
+	if err != nil {
+		return err
+	}
+	i, j, err := listRange(len(l), args[1], args[2])
+	if err != nil {
+		return err
+	}
+	s.setList(args[0], append([]string(nil), l[i:j]...))
+	return status("OK")
+}
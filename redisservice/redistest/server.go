@@ -0,0 +1,341 @@
+package redistest
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// Fault changes how the server handles the matching commands.
+type Fault struct {
+	// Command is the name of the affected command, all commands when empty.
+	Command string
+	// Delay is the time waited before the command is handled.
+	Delay time.Duration
+	// Err is replied as an error instead of executing the command.
+	Err string
+	// Drop closes the connection without replying.
+	Drop bool
+	// Times is the number of commands affected, unlimited when 0.
+	Times int
+}
+
+// Server is an in-process redis server keeping the data in memory. It
+// supports the common string, hash, list and expiry commands, transactions
+// and the scripts emulated with Script. The received commands are recorded
+// and faults can be injected to test the handling of slow and failing
+// servers.
+type Server struct {
+	ln net.Listener
+
+	lock     sync.Mutex
+	data     map[string]*entry
+	versions map[string]uint64
+	commands [][]string
+	faults   []*Fault
+	scripts  map[string]ScriptFunc
+	loaded   map[string]bool
+	conns    map[net.Conn]struct{}
+	wg       sync.WaitGroup
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// NewServer starts a server listening on a random local port.
+func NewServer() *Server {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("redistest: failed to listen: %v", err))
+	}
+	s := &Server{
+		ln:       ln,
+		data:     make(map[string]*entry),
+		versions: make(map[string]uint64),
+		scripts:  make(map[string]ScriptFunc),
+		loaded:   make(map[string]bool),
+		conns:    make(map[net.Conn]struct{}),
+		closed:   make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() string {
+	return s.ln.Addr().String()
+}
+
+// Dial connects to the server, it can be used as the Dial of a Pool.
+func (s *Server) Dial() (redis.Conn, error) {
+	return redis.Dial("tcp", s.Addr())
+}
+
+// Close stops the server and closes all the connections.
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	s.ln.Close()
+	s.CloseConns()
+	s.wg.Wait()
+}
+
+// CloseConns closes the open connections, e.g. to simulate a restart.
+func (s *Server) CloseConns() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for c := range s.conns {
+		c.Close()
+	}
+}
+
+// Commands returns the received commands with their arguments.
+func (s *Server) Commands() [][]string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([][]string(nil), s.commands...)
+}
+
+// CommandNames returns the upper-case names of the received commands.
+func (s *Server) CommandNames() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, len(s.commands))
+	for i, c := range s.commands {
+		names[i] = strings.ToUpper(c[0])
+	}
+	return names
+}
+
+// ResetCommands clears the recorded commands.
+func (s *Server) ResetCommands() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commands = nil
+}
+
+// Inject adds the fault, the first matching fault is applied to a command.
+func (s *Server) Inject(f Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f.Command = strings.ToUpper(f.Command)
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all the injected faults.
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+// ScriptFunc emulates a Lua script. The call function executes a command like
+// redis.call, its replies are nil, int64, string, []string, []interface{} or
+// error. The reply of the script can be of the same types.
+type ScriptFunc func(call func(args ...string) interface{}, keys, args []string) interface{}
+
+// Script registers the function executed atomically by EVAL and EVALSHA for
+// the script. Like in redis EVALSHA fails until the script is sent with EVAL
+// or SCRIPT LOAD.
+func (s *Server) Script(script string, f ScriptFunc) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.scripts[scriptSHA(script)] = f
+}
+
+func scriptSHA(script string) string {
+	h := sha1.Sum([]byte(script))
+	return hex.EncodeToString(h[:])
+}
+
+// FlushAll removes all the keys.
+func (s *Server) FlushAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.flush()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns[nc] = struct{}{}
+		s.lock.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c := &conn{server: s, Conn: nc, w: bufio.NewWriter(nc)}
+			c.serve()
+			s.lock.Lock()
+			delete(s.conns, nc)
+			s.lock.Unlock()
+			nc.Close()
+		}()
+	}
+}
+
+// fault returns the fault applied to the command and records the command.
+func (s *Server) fault(args []string) *Fault {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commands = append(s.commands, args)
+	name := strings.ToUpper(args[0])
+	for i, f := range s.faults {
+		if f.Command != "" && f.Command != name {
+			continue
+		}
+		if f.Times > 0 {
+			if f.Times--; f.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+type conn struct {
+	net.Conn
+	server *Server
+	w      *bufio.Writer
+
+	multi   bool
+	queued  [][]string
+	aborted bool
+	watched map[string]uint64
+}
+
+func (c *conn) serve() {
+	r := bufio.NewReader(c.Conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				writeReply(c.w, respError("ERR "+err.Error()))
+				c.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if f := c.server.fault(args); f != nil {
+			select {
+			case <-time.After(f.Delay):
+			case <-c.server.closed:
+				return
+			}
+			if f.Drop {
+				return
+			}
+			if f.Err != "" {
+				writeReply(c.w, respError(f.Err))
+				if c.w.Flush() != nil {
+					return
+				}
+				continue
+			}
+		}
+		writeReply(c.w, c.handle(args))
+		if c.w.Flush() != nil || strings.ToUpper(args[0]) == "QUIT" {
+			return
+		}
+	}
+}
+
+var errProtocol = errors.New("protocol error")
+
+// Limits of the commands read, as enforced by redis.
+const (
+	maxArgs     = 1024 * 1024
+	maxBulkSize = 512 * 1024 * 1024
+)
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	count, err := strconv.Atoi(line[1:])
+	if err != nil || count < 0 || count > maxArgs {
+		return nil, errProtocol
+	}
+	args := make([]string, count)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, errProtocol
+		}
+		size, err := strconv.Atoi(strings.TrimRight(line[1:], "\r\n"))
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, errProtocol
+		}
+		b := make([]byte, size+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		args[i] = string(b[:size])
+	}
+	return args, nil
+}
+
+type status string
+
+type respError string
+
+func writeReply(w *bufio.Writer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		w.WriteString("$-1\r\n")
+	case status:
+		fmt.Fprintf(w, "+%s\r\n", v)
+	case respError:
+		fmt.Fprintf(w, "-%s\r\n", v)
+	case int64:
+		fmt.Fprintf(w, ":%d\r\n", v)
+	case string:
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, s := range v {
+			writeReply(w, s)
+		}
+	case []interface{}:
+		if v == nil {
+			w.WriteString("*-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, e := range v {
+			writeReply(w, e)
+		}
+	default:
+		panic(fmt.Sprintf("redistest: unexpected reply %T", v))
+	}
+}
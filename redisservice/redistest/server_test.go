@@ -0,0 +1,245 @@
+package redistest_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice/redistest"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func dial(t *testing.T, s *redistest.Server) redis.Conn {
+	conn, err := s.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestServerStrings(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	_, err := redis.String(conn.Do("GET", "key"))
+	assert.Equal(t, redis.ErrNil, err)
+	ok, err := redis.String(conn.Do("SET", "key", "value"))
+	assert.NoError(t, err)
+	assert.Equal(t, "OK", ok)
+	v, err := redis.String(conn.Do("GET", "key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "value", v)
+
+	r, err := conn.Do("SET", "key", "other", "NX")
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	n, err := redis.Int64(conn.Do("INCRBY", "counter", 5))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	n, err = redis.Int64(conn.Do("DECR", "counter"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	values, err := redis.Strings(conn.Do("MGET", "key", "missing", "counter"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"value", "", "4"}, values)
+
+	_, err = conn.Do("INCR", "key")
+	assert.Error(t, err)
+	_, err = conn.Do("HGET", "key", "field")
+	assert.Error(t, err, "wrong type")
+
+	n, err = redis.Int64(conn.Do("DEL", "key", "counter", "missing"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
+
+func TestServerExpiry(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	conn.Do("SET", "key", "value", "PX", 10)
+	ttl, err := redis.Int64(conn.Do("PTTL", "key"))
+	assert.NoError(t, err)
+	assert.True(t, ttl > 0 && ttl <= 10)
+	time.Sleep(20 * time.Millisecond)
+	n, err := redis.Int64(conn.Do("EXISTS", "key"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), n)
+
+	conn.Do("SET", "key", "value")
+	ttl, _ = redis.Int64(conn.Do("TTL", "key"))
+	assert.Equal(t, int64(-1), ttl)
+	conn.Do("EXPIRE", "key", 100)
+	ttl, _ = redis.Int64(conn.Do("TTL", "key"))
+	assert.Equal(t, int64(100), ttl)
+	conn.Do("PERSIST", "key")
+	ttl, _ = redis.Int64(conn.Do("TTL", "key"))
+	assert.Equal(t, int64(-1), ttl)
+	ttl, _ = redis.Int64(conn.Do("TTL", "missing"))
+	assert.Equal(t, int64(-2), ttl)
+}
+
+func TestServerHashes(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	n, err := redis.Int64(conn.Do("HSET", "hash", "a", "1", "b", "2"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	conn.Do("HMSET", "hash", "c", "3")
+	m, err := redis.StringMap(conn.Do("HGETALL", "hash"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2", "c": "3"}, m)
+	n, _ = redis.Int64(conn.Do("HINCRBY", "hash", "a", 10))
+	assert.Equal(t, int64(11), n)
+	conn.Do("HDEL", "hash", "a", "b", "c")
+	n, _ = redis.Int64(conn.Do("EXISTS", "hash"))
+	assert.Equal(t, int64(0), n, "empty hash should be removed")
+}
+
+func TestServerLists(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	conn.Do("RPUSH", "list", "b", "c")
+	conn.Do("LPUSH", "list", "a")
+	values, err := redis.Strings(conn.Do("LRANGE", "list", 0, -1))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, values)
+	v, _ := redis.String(conn.Do("RPOP", "list"))
+	assert.Equal(t, "c", v)
+	v, _ = redis.String(conn.Do("LINDEX", "list", -1))
+	assert.Equal(t, "b", v)
+	n, _ := redis.Int64(conn.Do("LLEN", "list"))
+	assert.Equal(t, int64(2), n)
+}
+
+func TestServerTransaction(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+	other := dial(t, s)
+	defer other.Close()
+
+	conn.Send("MULTI")
+	conn.Send("SET", "key", "value")
+	conn.Send("INCR", "counter")
+	r, err := redis.Values(conn.Do("EXEC"))
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"OK", int64(1)}, r)
+
+	conn.Do("WATCH", "counter")
+	other.Do("INCR", "counter")
+	conn.Send("MULTI")
+	conn.Send("INCR", "counter")
+	r2, err := conn.Do("EXEC")
+	assert.NoError(t, err)
+	assert.Nil(t, r2, "transaction should be aborted")
+	n, _ := redis.Int64(conn.Do("GET", "counter"))
+	assert.Equal(t, int64(2), n)
+}
+
+func TestServerFaults(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	s.Inject(redistest.Fault{Command: "get", Err: "ERR injected", Times: 1})
+	_, err := conn.Do("GET", "key")
+	assert.Equal(t, redis.Error("ERR injected"), err)
+	_, err = conn.Do("GET", "key")
+	assert.NoError(t, err, "fault should be applied once")
+
+	s.Inject(redistest.Fault{Delay: 20 * time.Millisecond})
+	start := time.Now()
+	conn.Do("PING")
+	assert.True(t, time.Since(start) >= 20*time.Millisecond)
+	s.ClearFaults()
+
+	s.Inject(redistest.Fault{Command: "SET", Drop: true})
+	_, err = conn.Do("SET", "key", "value")
+	assert.Error(t, err)
+	assert.Error(t, conn.Err())
+
+	assert.Equal(t, []string{"GET", "GET", "PING", "SET"}, s.CommandNames())
+	assert.Equal(t, []string{"SET", "key", "value"}, s.Commands()[3])
+}
+
+func TestServerCloseConns(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	conn.Do("PING")
+	s.CloseConns()
+	_, err := conn.Do("PING")
+	assert.Error(t, err)
+}
+
+func TestServerProtocolError(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+
+	for _, cmd := range []string{"*-2\r\n", "*99999999999\r\n", "*1\r\n$-5\r\n"} {
+		conn, err := net.Dial("tcp", s.Addr())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write([]byte(cmd))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		assert.NoError(t, err)
+		assert.Equal(t, "-ERR protocol error\r\n", line, cmd)
+	}
+}
+
+func TestServerCloseDelayed(t *testing.T) {
+	s := redistest.NewServer()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	s.Inject(redistest.Fault{Delay: time.Minute})
+	go conn.Do("PING")
+	time.Sleep(10 * time.Millisecond)
+	start := time.Now()
+	s.Close()
+	assert.True(t, time.Since(start) < time.Second, "close should not wait for the delay")
+}
+
+func TestServerScript(t *testing.T) {
+	s := redistest.NewServer()
+	defer s.Close()
+	conn := dial(t, s)
+	defer conn.Close()
+
+	const src = `return redis.call("incrby", KEYS[1], ARGV[1])`
+	s.Script(src, func(call func(args ...string) interface{}, keys, args []string) interface{} {
+		return call("INCRBY", keys[0], args[0])
+	})
+	script := redis.NewScript(1, src)
+	n, err := redis.Int64(script.Do(conn, "counter", 2))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	n, err = redis.Int64(script.Do(conn, "counter", 3))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	assert.Equal(t, []string{"EVALSHA", "EVAL", "EVALSHA"}, s.CommandNames())
+
+	_, err = conn.Do("EVAL", "return 1", 0)
+	assert.Error(t, err, "unregistered script")
+}
@@ -0,0 +1,336 @@
+package redisservice
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/garyburd/redigo/redis"
+)
+
+const defaultDialTimeout = 3 * time.Second
+
+var (
+	errNoSentinels    = errors.New("redis: no sentinels")
+	errMasterSwitched = errors.New("redis: master switched")
+)
+
+// Sentinel discovers the master and the replicas of MasterName through Redis
+// Sentinel. The master pool is configured with
+//
+//	pool := &redisservice.Pool{
+//		Dial:         sentinel.DialMaster,
+//		TestOnBorrow: sentinel.TestOnBorrow,
+//	}
+//
+// and Watch must be running to close the connections to the old master when
+// it is switched.
+type Sentinel struct {
+	Addrs      []string
+	MasterName string
+	// Dial dials the sentinels and the redis servers, with TCP by default.
+	Dial func(addr string) (redis.Conn, error)
+	// ConnectTimeout, ReadTimeout and WriteTimeout are the timeouts of the
+	// connections made by the default Dial, 3s by default.
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	WriteTimeout   time.Duration
+
+	lock       sync.Mutex
+	master     string
+	generation uint64
+}
+
+func (s *Sentinel) dial(addr string) (redis.Conn, error) {
+	return s.dialReadTimeout(addr, timeoutOrDefault(s.ReadTimeout))
+}
+
+// dialReadTimeout dials with the read timeout, reads do not time out when it
+// is zero.
+func (s *Sentinel) dialReadTimeout(addr string, readTimeout time.Duration) (redis.Conn, error) {
+	if s.Dial != nil {
+		return s.Dial(addr)
+	}
+	return redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(timeoutOrDefault(s.ConnectTimeout)),
+		redis.DialReadTimeout(readTimeout),
+		redis.DialWriteTimeout(timeoutOrDefault(s.WriteTimeout)))
+}
+
+func timeoutOrDefault(d time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultDialTimeout
+	}
+	return d
+}
+
+// query runs the command on the sentinels until one of them replies. The
+// sentinel that replied is tried first the next time.
+func (s *Sentinel) query(cmd string, args ...interface{}) (interface{}, error) {
+	s.lock.Lock()
+	addrs := append([]string(nil), s.Addrs...)
+	s.lock.Unlock()
+	err := errNoSentinels
+	for i, addr := range addrs {
+		var conn redis.Conn
+		conn, err = s.dial(addr)
+		if err != nil {
+			continue
+		}
+		var r interface{}
+		r, err = conn.Do(cmd, args...)
+		conn.Close()
+		if err != nil {
+			continue
+		}
+		if i > 0 {
+			s.lock.Lock()
+			for j, a := range s.Addrs {
+				if a == addr {
+					s.Addrs[0], s.Addrs[j] = s.Addrs[j], s.Addrs[0]
+					break
+				}
+			}
+			s.lock.Unlock()
+		}
+		return r, nil
+	}
+	return nil, err
+}
+
+// MasterAddr asks the sentinels for the address of the master.
+func (s *Sentinel) MasterAddr() (string, error) {
+	r, err := redis.Strings(s.query("SENTINEL", "get-master-addr-by-name", s.MasterName))
+	if err != nil {
+		return "", err
+	}
+	if len(r) != 2 {
+		return "", errors.New("redis: invalid master address reply")
+	}
+	addr := net.JoinHostPort(r[0], r[1])
+	s.setMaster(addr)
+	return addr, nil
+}
+
+// ReplicaAddrs asks the sentinels for the addresses of the healthy replicas.
+func (s *Sentinel) ReplicaAddrs() ([]string, error) {
+	replicas, err := redis.Values(s.query("SENTINEL", "slaves", s.MasterName))
+	if err != nil {
+		return nil, err
+	}
+	var addrs []string
+	for _, r := range replicas {
+		info, err := redis.StringMap(r, nil)
+		if err != nil {
+			return nil, err
+		}
+		flags := info["flags"]
+		if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(info["ip"], info["port"]))
+	}
+	return addrs, nil
+}
+
+// setMaster records the address of the master, the connections to the
+// previous one become stale.
+func (s *Sentinel) setMaster(addr string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.master != "" && s.master != addr {
+		atomic.AddUint64(&s.generation, 1)
+	}
+	s.master = addr
+}
+
+func checkRole(conn redis.Conn, role string) error {
+	r, err := redis.Values(conn.Do("ROLE"))
+	if err != nil {
+		return err
+	}
+	if len(r) == 0 {
+		return errors.New("redis: invalid ROLE reply")
+	}
+	actual, err := redis.String(r[0], nil)
+	if err != nil {
+		return err
+	}
+	if actual != role {
+		return errors.New("redis: expected role " + role + " but got " + actual)
+	}
+	return nil
+}
+
+// DialMaster dials the master and verifies its role.
+func (s *Sentinel) DialMaster() (redis.Conn, error) {
+	addr, err := s.MasterAddr()
+	if err != nil {
+		return nil, err
+	}
+	generation := atomic.LoadUint64(&s.generation)
+	conn, err := s.dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRole(conn, "master"); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &masterConn{Conn: conn, sentinel: s, generation: generation}, nil
+}
+
+// DialReplica dials a random healthy replica, the master when there are none.
+func (s *Sentinel) DialReplica() (redis.Conn, error) {
+	addrs, err := s.ReplicaAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range rand.Perm(len(addrs)) {
+		conn, err := s.dial(addrs[i])
+		if err != nil {
+			continue
+		}
+		if err := checkRole(conn, "slave"); err != nil {
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+	return s.DialMaster()
+}
+
+// TestOnBorrow rejects the idle connections to a previous master.
+func (s *Sentinel) TestOnBorrow(c redis.Conn, t time.Time) error {
+	return c.Err()
+}
+
+// Watch listens for +switch-master events on the sentinels until the
+// context is done. The subscription is kept alive with pings, a sentinel that
+// does not reply within twice the ReadTimeout is replaced.
+func (s *Sentinel) Watch(ctx context.Context) error {
+	var next uint32
+	sub := &Subscriber{
+		Pool: &Pool{
+			Dial: func() (redis.Conn, error) {
+				s.lock.Lock()
+				addrs := append([]string(nil), s.Addrs...)
+				s.lock.Unlock()
+				if len(addrs) == 0 {
+					return nil, errNoSentinels
+				}
+				// The subscription is idle between the events.
+				return s.dialReadTimeout(addrs[int(atomic.AddUint32(&next, 1))%len(addrs)], 0)
+			},
+		},
+		Channels:    []string{"+switch-master"},
+		HealthCheck: timeoutOrDefault(s.ReadTimeout),
+		Handler: saola.FuncService(func(ctx context.Context) error {
+			// <master name> <old ip> <old port> <new ip> <new port>
+			parts := strings.Fields(string(GetMessage(ctx).Data))
+			if len(parts) == 5 && parts[0] == s.MasterName {
+				s.setMaster(net.JoinHostPort(parts[3], parts[4]))
+			}
+			return nil
+		}),
+		OnError: func(err error) {
+			// The master may have been switched while disconnected.
+			s.MasterAddr()
+		},
+	}
+	return sub.Run(ctx)
+}
+
+// masterConn is stale after the master is switched so that it is not
+// returned to the pool.
+type masterConn struct {
+	redis.Conn
+	sentinel   *Sentinel
+	generation uint64
+}
+
+func (c *masterConn) Err() error {
+	if atomic.LoadUint64(&c.sentinel.generation) != c.generation {
+		return errMasterSwitched
+	}
+	return c.Conn.Err()
+}
+
+func (c *masterConn) DoWithTimeout(timeout time.Duration, cmd string, args ...interface{}) (interface{}, error) {
+	return redis.DoWithTimeout(c.Conn, timeout, cmd, args...)
+}
+
+func (c *masterConn) ReceiveWithTimeout(timeout time.Duration) (interface{}, error) {
+	return redis.ReceiveWithTimeout(c.Conn, timeout)
+}
+
+// RoutingClient sends the read-only commands to the Replicas and the other
+// commands to the Master, each command on a connection from the pool.
+type RoutingClient struct {
+	Master   *Pool
+	Replicas *Pool
+}
+
+func (c *RoutingClient) pool(cmds ...string) *Pool {
+	if c.Replicas == nil {
+		return c.Master
+	}
+	for _, cmd := range cmds {
+		if !readOnlyCommands[strings.ToUpper(cmd)] {
+			return c.Master
+		}
+	}
+	return c.Replicas
+}
+
+func (c *RoutingClient) Do(ctx context.Context, cmd string, args ...interface{}) (interface{}, error) {
+	conn, err := c.pool(cmd).GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.Do(ctx, cmd, args...)
+}
+
+func (c *RoutingClient) Send(ctx context.Context, cmd string, args ...interface{}) error {
+	return errSendNotSupported
+}
+
+// Pipeline is sent to the replicas only when all the commands are read-only.
+func (c *RoutingClient) Pipeline(ctx context.Context, cmds ...*Cmd) error {
+	names := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		names[i] = cmd.Command
+	}
+	conn, err := c.pool(names...).GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Pipeline(ctx, cmds...)
+}
+
+func (c *RoutingClient) Transaction(ctx context.Context, cmds ...*Cmd) error {
+	conn, err := c.Master.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Transaction(ctx, cmds...)
+}
+
+func (c *RoutingClient) Close() error {
+	err := c.Master.Close()
+	if c.Replicas != nil {
+		if e := c.Replicas.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
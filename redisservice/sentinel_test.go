@@ -0,0 +1,270 @@
+package redisservice_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSentinel serves the sentinel commands and the ROLE of the servers.
+type fakeSentinel struct {
+	lock       sync.Mutex
+	master     string
+	roles      map[string]string
+	dials      []string
+	subscriber *subscriberConn
+}
+
+func (f *fakeSentinel) setMaster(addr string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.master = addr
+}
+
+func (f *fakeSentinel) dial(addr string) (redis.Conn, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.dials = append(f.dials, addr)
+	do := func(cmd string, args ...interface{}) (interface{}, error) {
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		switch {
+		case cmd == "SENTINEL" && args[0] == "get-master-addr-by-name":
+			return []interface{}{[]byte(f.master[:len(f.master)-5]), []byte("6379")}, nil
+		case cmd == "SENTINEL" && args[0] == "slaves":
+			return []interface{}{
+				[]interface{}{[]byte("ip"), []byte("10.0.0.2"), []byte("port"), []byte("6379"), []byte("flags"), []byte("slave")},
+				[]interface{}{[]byte("ip"), []byte("10.0.0.9"), []byte("port"), []byte("6379"), []byte("flags"), []byte("slave,s_down")},
+			}, nil
+		case cmd == "ROLE":
+			return []interface{}{[]byte(f.roles[addr])}, nil
+		}
+		return "OK", nil
+	}
+	if addr == "sentinel:26379" && f.subscriber != nil {
+		f.subscriber.DoFunc = do
+		return f.subscriber, nil
+	}
+	if addr == "10.0.0.9:6379" {
+		return nil, errors.New("down")
+	}
+	return &MockConn{DoFunc: do}, nil
+}
+
+func (f *fakeSentinel) dialed() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]string(nil), f.dials...)
+}
+
+func newFakeSentinel() (*fakeSentinel, *redisservice.Sentinel) {
+	f := &fakeSentinel{
+		master: "10.0.0.1:6379",
+		roles: map[string]string{
+			"10.0.0.1:6379": "master",
+			"10.0.0.2:6379": "slave",
+			"10.0.0.3:6379": "master",
+		},
+	}
+	return f, &redisservice.Sentinel{
+		Addrs:      []string{"down:26379", "sentinel:26379"},
+		MasterName: "mymaster",
+		Dial: func(addr string) (redis.Conn, error) {
+			if addr == "down:26379" {
+				return nil, errors.New("down")
+			}
+			return f.dial(addr)
+		},
+	}
+}
+
+func TestSentinelDialMaster(t *testing.T) {
+	f, s := newFakeSentinel()
+	conn, err := s.DialMaster()
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Err())
+	assert.Equal(t, []string{"sentinel:26379", "10.0.0.1:6379"}, f.dialed())
+	assert.Equal(t, []string{"sentinel:26379", "down:26379"}, s.Addrs, "responding sentinel should be tried first")
+
+	f.setMaster("10.0.0.2:6379")
+	_, err = s.DialMaster()
+	assert.Error(t, err, "replica should not be used as the master")
+}
+
+func TestSentinelReadTimeout(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		// Accepts the connections but never replies.
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	s := &redisservice.Sentinel{
+		Addrs:       []string{ln.Addr().String()},
+		MasterName:  "mymaster",
+		ReadTimeout: 20 * time.Millisecond,
+	}
+	start := time.Now()
+	_, err = s.MasterAddr()
+	assert.Error(t, err)
+	assert.True(t, time.Now().Sub(start) < time.Second, "unresponsive sentinel should time out")
+}
+
+// readArgs reads a command sent by a client.
+func readArgs(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if _, err := r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSpace(arg)
+	}
+	return args, nil
+}
+
+func TestSentinelWatchIdle(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer ln.Close()
+	var lock sync.Mutex
+	var subscribes int
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					args, err := readArgs(r)
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(args[0]) {
+					case "SUBSCRIBE":
+						lock.Lock()
+						subscribes++
+						lock.Unlock()
+						fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:1\r\n", len(args[1]), args[1])
+					case "PING":
+						conn.Write([]byte("*2\r\n$4\r\npong\r\n$0\r\n\r\n"))
+					default:
+						conn.Write([]byte("*2\r\n$9\r\n127.0.0.1\r\n$4\r\n6379\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	s := &redisservice.Sentinel{
+		Addrs:       []string{ln.Addr().String()},
+		MasterName:  "mymaster",
+		ReadTimeout: 20 * time.Millisecond,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Watch(ctx))
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 1, subscribes, "idle subscription should not be reconnected")
+}
+
+func TestSentinelDialReplica(t *testing.T) {
+	f, s := newFakeSentinel()
+	conn, err := s.DialReplica()
+	assert.NoError(t, err)
+	assert.NotNil(t, conn)
+	assert.Equal(t, "10.0.0.2:6379", f.dialed()[len(f.dialed())-1])
+}
+
+func TestSentinelSwitchMaster(t *testing.T) {
+	f, s := newFakeSentinel()
+	subscribed := make(chan []interface{}, 10)
+	f.subscriber = newSubscriberConn(subscribed)
+	pool := &redisservice.Pool{
+		Dial:         s.DialMaster,
+		TestOnBorrow: s.TestOnBorrow,
+	}
+	pool.Get().Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Watch(ctx)
+	<-subscribed
+
+	f.setMaster("10.0.0.3:6379")
+	f.subscriber.replies <- []interface{}{[]byte("message"), []byte("+switch-master"),
+		[]byte("mymaster 10.0.0.1 6379 10.0.0.3 6379")}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn := pool.Get()
+		conn.Close()
+		dials := f.dialed()
+		if dials[len(dials)-1] == "10.0.0.3:6379" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("connection to the new master should be dialed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRoutingClient(t *testing.T) {
+	var lock sync.Mutex
+	var commands []string
+	pool := func(name string) *redisservice.Pool {
+		return &redisservice.Pool{
+			Dial: func() (redis.Conn, error) {
+				return &MockConn{
+					DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+						lock.Lock()
+						defer lock.Unlock()
+						if cmd != "" {
+							commands = append(commands, name+" "+cmd)
+						}
+						return nil, nil
+					},
+				}, nil
+			},
+		}
+	}
+	c := &redisservice.RoutingClient{Master: pool("master"), Replicas: pool("replica")}
+	defer c.Close()
+	ctx := context.Background()
+	c.Do(ctx, "GET", "key")
+	c.Do(ctx, "SET", "key", "value")
+	c.Do(ctx, "hgetall", "key")
+	assert.Equal(t, []string{"replica GET", "master SET", "replica hgetall"}, commands)
+	assert.Error(t, c.Send(ctx, "GET", "key"))
+}
@@ -0,0 +1,36 @@
+package redisservice
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/arjantop/saola"
+	"github.com/arjantop/saola/stats"
+)
+
+// NewCommandStatsFilter records the stats of each command under
+// <service>.command.<COMMAND>.
+func NewCommandStatsFilter(stats stats.StatsReceiver) saola.Filter {
+	return saola.FuncFilter(func(ctx context.Context, s saola.Service) error {
+		req := GetClientRequest(ctx)
+		if req == nil {
+			return s.Do(ctx)
+		}
+		command := strings.ToUpper(req.Command)
+
+		start := time.Now()
+		err := s.Do(ctx)
+		latency := time.Now().Sub(start)
+
+		commandStats := stats.Scope(s.Name()).Scope("command").Scope(command)
+		commandStats.Counter("requests").Incr()
+		commandStats.Timer("latency").Add(latency)
+		if err != nil {
+			commandStats.Counter("failure").Incr()
+		} else {
+			commandStats.Counter("success").Incr()
+		}
+		return err
+	})
+}
@@ -0,0 +1,39 @@
+package redisservice_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/arjantop/saola/redisservice"
+	"github.com/arjantop/saola/stats/statstest"
+	"github.com/garyburd/redigo/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandStatsFilter(t *testing.T) {
+	r := statstest.NewRecorder()
+	pool := redisservice.Pool{
+		Filter: redisservice.NewCommandStatsFilter(r),
+		Dial: func() (redis.Conn, error) {
+			return &MockConn{
+				DoFunc: func(cmd string, args ...interface{}) (interface{}, error) {
+					if cmd == "incr" {
+						return nil, redis.Error("ERR value is not an integer")
+					}
+					return nil, nil
+				},
+			}, nil
+		},
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	conn.Do(context.Background(), "GET", "key")
+	conn.Do(context.Background(), "GET", "key")
+	conn.Do(context.Background(), "incr", "key")
+
+	assert.Equal(t, int64(2), r.CounterValue("redis.command.GET.requests"))
+	assert.Equal(t, int64(2), r.CounterValue("redis.command.GET.success"))
+	assert.Equal(t, int64(1), r.CounterValue("redis.command.INCR.requests"))
+	assert.Equal(t, int64(1), r.CounterValue("redis.command.INCR.failure"))
+	assert.True(t, r.TimerValue("redis.command.GET.latency") >= 0)
+}
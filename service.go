@@ -1,6 +1,6 @@
 package saola
 
-import "golang.org/x/net/context"
+import "context"
 
 type Filter interface {
 	Do(ctx context.Context, s Service) error
@@ -1,12 +1,12 @@
 package saola_test
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/arjantop/saola"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func WithString(ctx context.Context) context.Context {
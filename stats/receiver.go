@@ -5,6 +5,8 @@ import "time"
 type StatsReceiver interface {
 	Counter(string) Counter
 	Timer(string) Timer
+	Stat(string) Stat
+	Gauge(string) Gauge
 	Scope(string) StatsReceiver
 }
 
@@ -17,6 +19,17 @@ type Timer interface {
 	Add(time.Duration)
 }
 
+// Stat records a distribution of values, e.g. as a histogram.
+type Stat interface {
+	Add(float64)
+}
+
+// Gauge records the instantaneous value of a measurement.
+type Gauge interface {
+	Set(float64)
+	Add(float64)
+}
+
 func ScopedName(scope, name string) string {
 	if len(scope) != 0 {
 		return scope + "." + name
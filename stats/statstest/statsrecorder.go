@@ -1,51 +1,87 @@
 package statstest
 
 import (
+	"sync"
 	"time"
 
 	"github.com/arjantop/saola/stats"
 )
 
-type StatsRecorder struct {
-	scope    string
+// records are shared by a recorder and its scopes.
+type records struct {
+	lock     sync.Mutex
 	counters map[string]int64
 	timers   map[string]time.Duration
+	stats    map[string][]float64
+	gauges   map[string]float64
+}
+
+type StatsRecorder struct {
+	scope string
+	*records
 }
 
 func NewRecorder() *StatsRecorder {
 	return &StatsRecorder{
-		counters: make(map[string]int64),
-		timers:   make(map[string]time.Duration),
+		records: &records{
+			counters: make(map[string]int64),
+			timers:   make(map[string]time.Duration),
+			stats:    make(map[string][]float64),
+			gauges:   make(map[string]float64),
+		},
 	}
 }
 
 func (r *StatsRecorder) CounterValue(name string) int64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 	return r.counters[name]
 }
 
 func (r *StatsRecorder) TimerValue(name string) time.Duration {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 	return r.timers[name]
 }
 
+func (r *StatsRecorder) StatValues(name string) []float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stats[name]
+}
+
+func (r *StatsRecorder) GaugeValue(name string) float64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.gauges[name]
+}
+
 func (r *StatsRecorder) Counter(name string) stats.Counter {
-	return counter{stats.ScopedName(r.scope, name), r.counters}
+	return counter{stats.ScopedName(r.scope, name), r.records}
 }
 
 func (r *StatsRecorder) Timer(name string) stats.Timer {
-	return timer{stats.ScopedName(r.scope, name), r.timers}
+	return timer{stats.ScopedName(r.scope, name), r.records}
+}
+
+func (r *StatsRecorder) Stat(name string) stats.Stat {
+	return stat{stats.ScopedName(r.scope, name), r.records}
+}
+
+func (r *StatsRecorder) Gauge(name string) stats.Gauge {
+	return gauge{stats.ScopedName(r.scope, name), r.records}
 }
 
 func (r *StatsRecorder) Scope(scope string) stats.StatsReceiver {
 	return &StatsRecorder{
-		scope:    stats.ScopedName(r.scope, scope),
-		counters: r.counters,
-		timers:   r.timers,
+		scope:   stats.ScopedName(r.scope, scope),
+		records: r.records,
 	}
 }
 
 type counter struct {
-	name     string
-	counters map[string]int64
+	name string
+	*records
 }
 
 func (c counter) Incr() {
@@ -53,22 +89,46 @@ func (c counter) Incr() {
 }
 
 func (c counter) Add(delta int64) {
-	if count, ok := c.counters[c.name]; ok {
-		c.counters[c.name] = count + delta
-	} else {
-		c.counters[c.name] = delta
-	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.counters[c.name] += delta
 }
 
 type timer struct {
-	name   string
-	timers map[string]time.Duration
+	name string
+	*records
 }
 
 func (t timer) Add(d time.Duration) {
-	if time, ok := t.timers[t.name]; ok {
-		t.timers[t.name] = time + d
-	} else {
-		t.timers[t.name] = d
-	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.timers[t.name] += d
+}
+
+type stat struct {
+	name string
+	*records
+}
+
+func (s stat) Add(value float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats[s.name] = append(s.stats[s.name], value)
+}
+
+type gauge struct {
+	name string
+	*records
+}
+
+func (g gauge) Set(value float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.gauges[g.name] = value
+}
+
+func (g gauge) Add(delta float64) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.gauges[g.name] += delta
 }
@@ -56,6 +56,25 @@ func TestStatsRecorderMultipleTimerInstances(t *testing.T) {
 	assert.Equal(t, 61*time.Second, r.TimerValue("a"))
 }
 
+func TestStatsRecorderStat(t *testing.T) {
+	r := statstest.NewRecorder()
+	s1 := r.Stat("a.b")
+	s1.Add(1.5)
+	r.Stat("a.b").Add(2)
+	assert.Equal(t, []float64{1.5, 2}, r.StatValues("a.b"))
+	assert.Nil(t, r.StatValues("a.c"))
+}
+
+func TestStatsRecorderGauge(t *testing.T) {
+	r := statstest.NewRecorder()
+	g := r.Gauge("a.b")
+	g.Add(2)
+	g.Add(-1)
+	assert.Equal(t, 1.0, r.GaugeValue("a.b"))
+	g.Set(5)
+	assert.Equal(t, 5.0, r.GaugeValue("a.b"))
+}
+
 func TestStatsRecorderScope(t *testing.T) {
 	r := statstest.NewRecorder()
 	s1 := r.Scope("a")
@@ -66,6 +85,12 @@ func TestStatsRecorderScope(t *testing.T) {
 	t1 := s1.Timer("b")
 	t1.Add(time.Second)
 	assert.Equal(t, time.Second, r.TimerValue("a.b"))
+
+	s1.Stat("c").Add(1)
+	assert.Equal(t, []float64{1}, r.StatValues("a.c"))
+
+	s1.Gauge("d").Set(1)
+	assert.Equal(t, 1.0, r.GaugeValue("a.d"))
 }
 
 func TestStatsRecorderNestedScope(t *testing.T) {
@@ -1,32 +1,45 @@
 package saola
 
 import (
+	"context"
 	"time"
 
 	"github.com/arjantop/saola/stats"
-	"golang.org/x/net/context"
 )
 
+func recordStats(stats stats.StatsReceiver, name string, start time.Time, err error) {
+	latency := time.Now().Sub(start)
+
+	serviceStats := stats.Scope(name)
+	requestsStat := serviceStats.Counter("requests")
+	successStat := serviceStats.Counter("success")
+	failureStat := serviceStats.Counter("failure")
+	latencyStat := serviceStats.Timer("latency")
+
+	requestsStat.Incr()
+	latencyStat.Add(latency)
+	if err != nil {
+		failureStat.Incr()
+	} else {
+		successStat.Incr()
+	}
+}
+
 func NewStatsFilter(stats stats.StatsReceiver) Filter {
 	return FuncFilter(func(ctx context.Context, s Service) error {
 		start := time.Now()
 		err := s.Do(ctx)
-		latency := time.Now().Sub(start)
-
-		serviceStats := stats.Scope(s.Name())
-		requestsStat := serviceStats.Counter("requests")
-		successStat := serviceStats.Counter("success")
-		failureStat := serviceStats.Counter("failure")
-		latencyStat := serviceStats.Timer("latency")
-
-		requestsStat.Incr()
-		latencyStat.Add(latency)
-		if err != nil {
-			failureStat.Incr()
-		} else {
-			successStat.Incr()
-		}
-
+		recordStats(stats, s.Name(), start, err)
 		return err
 	})
 }
+
+// NewStatsFlt is the typed version of NewStatsFilter.
+func NewStatsFlt[Req, Rep any](stats stats.StatsReceiver) Flt[Req, Rep] {
+	return func(ctx context.Context, req Req, s Svc[Req, Rep]) (Rep, error) {
+		start := time.Now()
+		rep, err := s.Call(ctx, req)
+		recordStats(stats, s.Name(), start, err)
+		return rep, err
+	}
+}
@@ -1,13 +1,13 @@
 package saola_test
 
 import (
+	"context"
 	"errors"
 	"testing"
 
 	"github.com/arjantop/saola"
 	"github.com/arjantop/saola/stats/statstest"
 	"github.com/stretchr/testify/assert"
-	"golang.org/x/net/context"
 )
 
 func TestStatsFilter(t *testing.T) {
@@ -40,3 +40,21 @@ func BenchmarkStatsFilter(b *testing.B) {
 		s.Do(ctx)
 	}
 }
+
+func TestStatsFlt(t *testing.T) {
+	r := statstest.NewRecorder()
+	s := saola.NewStatsFlt[int, int](r).Apply(saola.FuncSvc[int, int](func(ctx context.Context, req int) (int, error) {
+		if req < 0 {
+			return 0, errors.New("negative")
+		}
+		return req, nil
+	}))
+	rep, err := s.Call(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, rep)
+	_, err = s.Call(context.Background(), -1)
+	assert.Error(t, err)
+	assert.Equal(t, int64(2), r.CounterValue("func.requests"))
+	assert.Equal(t, int64(1), r.CounterValue("func.success"))
+	assert.Equal(t, int64(1), r.CounterValue("func.failure"))
+}
@@ -0,0 +1,145 @@
+package saola
+
+import (
+	"context"
+	"errors"
+)
+
+var errMissingExchange = errors.New("missing exchange in context")
+
+// Svc is a service with a typed request and response.
+type Svc[Req, Rep any] interface {
+	Call(ctx context.Context, req Req) (Rep, error)
+	Name() string
+}
+
+type FuncSvc[Req, Rep any] func(ctx context.Context, req Req) (Rep, error)
+
+func (f FuncSvc[Req, Rep]) Call(ctx context.Context, req Req) (Rep, error) {
+	return f(ctx, req)
+}
+
+func (f FuncSvc[Req, Rep]) Name() string {
+	return "func"
+}
+
+// Flt is a filter of a typed service.
+type Flt[Req, Rep any] func(ctx context.Context, req Req, s Svc[Req, Rep]) (Rep, error)
+
+// AndThen returns a filter that applies f before next.
+func (f Flt[Req, Rep]) AndThen(next Flt[Req, Rep]) Flt[Req, Rep] {
+	return func(ctx context.Context, req Req, s Svc[Req, Rep]) (Rep, error) {
+		return f(ctx, req, next.Apply(s))
+	}
+}
+
+// Apply returns the service filtered by f.
+func (f Flt[Req, Rep]) Apply(s Svc[Req, Rep]) Svc[Req, Rep] {
+	return filteredSvc[Req, Rep]{s, f}
+}
+
+type filteredSvc[Req, Rep any] struct {
+	original Svc[Req, Rep]
+	filter   Flt[Req, Rep]
+}
+
+func (s filteredSvc[Req, Rep]) Call(ctx context.Context, req Req) (Rep, error) {
+	return s.filter(ctx, req, s.original)
+}
+
+func (s filteredSvc[Req, Rep]) Name() string {
+	return s.original.Name()
+}
+
+// Exchange carries the request and response of a typed service through the
+// context of a Service.
+type Exchange[Req, Rep any] struct {
+	Request  Req
+	Response Rep
+}
+
+type exchangeKey[Req, Rep any] struct{}
+
+func WithExchange[Req, Rep any](ctx context.Context, e *Exchange[Req, Rep]) context.Context {
+	return context.WithValue(ctx, exchangeKey[Req, Rep]{}, e)
+}
+
+func GetExchange[Req, Rep any](ctx context.Context) (*Exchange[Req, Rep], bool) {
+	e, ok := ctx.Value(exchangeKey[Req, Rep]{}).(*Exchange[Req, Rep])
+	return e, ok
+}
+
+type svcService[Req, Rep any] struct {
+	svc Svc[Req, Rep]
+}
+
+func (s svcService[Req, Rep]) Do(ctx context.Context) error {
+	e, ok := GetExchange[Req, Rep](ctx)
+	if !ok {
+		return errMissingExchange
+	}
+	rep, err := s.svc.Call(ctx, e.Request)
+	e.Response = rep
+	return err
+}
+
+func (s svcService[Req, Rep]) Name() string {
+	return s.svc.Name()
+}
+
+type serviceSvc[Req, Rep any] struct {
+	service Service
+}
+
+func (s serviceSvc[Req, Rep]) Call(ctx context.Context, req Req) (Rep, error) {
+	e := &Exchange[Req, Rep]{Request: req}
+	err := s.service.Do(WithExchange(ctx, e))
+	return e.Response, err
+}
+
+func (s serviceSvc[Req, Rep]) Name() string {
+	return s.service.Name()
+}
+
+// ToService adapts a typed service to a Service that reads the request from
+// and writes the response to the Exchange in the context.
+func ToService[Req, Rep any](s Svc[Req, Rep]) Service {
+	if ss, ok := s.(serviceSvc[Req, Rep]); ok {
+		return ss.service
+	}
+	return svcService[Req, Rep]{s}
+}
+
+// FromService adapts a Service that uses the Exchange in the context to a
+// typed service.
+func FromService[Req, Rep any](s Service) Svc[Req, Rep] {
+	if ss, ok := s.(svcService[Req, Rep]); ok {
+		return ss.svc
+	}
+	return serviceSvc[Req, Rep]{s}
+}
+
+// ToFilter adapts a typed filter to a Filter of services using the Exchange
+// in the context.
+func ToFilter[Req, Rep any](f Flt[Req, Rep]) Filter {
+	return FuncFilter(func(ctx context.Context, s Service) error {
+		e, ok := GetExchange[Req, Rep](ctx)
+		if !ok {
+			return errMissingExchange
+		}
+		rep, err := f(ctx, e.Request, FromService[Req, Rep](s))
+		e.Response = rep
+		return err
+	})
+}
+
+// FromFilter adapts a Filter to a typed filter, e.g. to use the stats filter
+// with typed services. Filters that run the service concurrently, like the
+// hedging filter, are unsafe to adapt as all the attempts share one Exchange.
+func FromFilter[Req, Rep any](f Filter) Flt[Req, Rep] {
+	return func(ctx context.Context, req Req, s Svc[Req, Rep]) (Rep, error) {
+		e := &Exchange[Req, Rep]{Request: req}
+		err := f.Do(WithExchange(ctx, e), ToService(s))
+		return e.Response, err
+	}
+}
@@ -0,0 +1,69 @@
+package saola_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/arjantop/saola"
+	"github.com/stretchr/testify/assert"
+)
+
+var itoaSvc = saola.FuncSvc[int, string](func(ctx context.Context, req int) (string, error) {
+	return strconv.Itoa(req), nil
+})
+
+func wrapFlt(name string) saola.Flt[int, string] {
+	return func(ctx context.Context, req int, s saola.Svc[int, string]) (string, error) {
+		rep, err := s.Call(ctx, req+1)
+		return name + "(" + rep + ")", err
+	}
+}
+
+func TestFltAndThen(t *testing.T) {
+	s := wrapFlt("a").AndThen(wrapFlt("b")).Apply(itoaSvc)
+	rep, err := s.Call(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "a(b(3))", rep)
+	assert.Equal(t, "func", s.Name())
+}
+
+func TestToService(t *testing.T) {
+	s := saola.ToService[int, string](itoaSvc)
+	e := &saola.Exchange[int, string]{Request: 42}
+	assert.NoError(t, s.Do(saola.WithExchange(context.Background(), e)))
+	assert.Equal(t, "42", e.Response)
+
+	assert.Error(t, s.Do(context.Background()))
+}
+
+func TestFromService(t *testing.T) {
+	s := saola.FromService[int, string](saola.FuncService(func(ctx context.Context) error {
+		e, ok := saola.GetExchange[int, string](ctx)
+		assert.True(t, ok)
+		e.Response = strconv.Itoa(e.Request * 2)
+		return nil
+	}))
+	rep, err := s.Call(context.Background(), 21)
+	assert.NoError(t, err)
+	assert.Equal(t, "42", rep)
+}
+
+func TestFromFilter(t *testing.T) {
+	ctx := WithString(context.Background())
+	s := saola.FromFilter[int, string](NewFilter("f")).Apply(saola.FuncSvc[int, string](func(ctx context.Context, req int) (string, error) {
+		WriteString(ctx, "service")
+		return strconv.Itoa(req), nil
+	}))
+	rep, err := s.Call(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", rep)
+	assert.Equal(t, "f-service-f", GetString(ctx))
+}
+
+func TestToFilter(t *testing.T) {
+	s := saola.Apply(saola.ToService[int, string](itoaSvc), saola.ToFilter(wrapFlt("a")))
+	rep, err := saola.FromService[int, string](s).Call(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "a(2)", rep)
+}